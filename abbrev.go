@@ -0,0 +1,99 @@
+package flagstruct
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	flag "github.com/spf13/pflag"
+)
+
+// for abbreviated flag, e.g. `--verb` is treated as `--verbose` (if unambiguous)
+//
+// the aliases are treated as their canonical flags (e.g. `--t` with `--timeout` and `--ttl` is not ambiguous),
+// and the hidden negative flags (e.g. `--no-verbose`) are not candidates.
+
+func expandAbbrevFlags(fs *flag.FlagSet, args []string, aliases map[string]string) ([]string, error) {
+	r := make([]string, 0, len(args))
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if arg == "--" {
+			r = append(r, args[i:]...)
+			break
+		}
+		if !strings.HasPrefix(arg, "--") || len(arg) == 2 {
+			r = append(r, arg)
+			// the next argument is the value of the shorthand flag (e.g. `-o --verb`)
+			if strings.HasPrefix(arg, "-") && shorthandNeedsNextArg(fs, arg[1:]) && i+1 < len(args) {
+				i++
+				r = append(r, args[i])
+			}
+			continue
+		}
+
+		parts := strings.SplitN(arg[2:], "=", 2)
+		name := parts[0]
+		f := fs.Lookup(name)
+		if f == nil {
+			normalized := string(fs.GetNormalizeFunc()(fs, name))
+			var candidates []*flag.Flag
+			seen := map[string]bool{}
+			fs.VisitAll(func(f *flag.Flag) {
+				if !strings.HasPrefix(f.Name, normalized) {
+					return
+				}
+				if _, ok := f.Value.(*negativeBoolValue); ok {
+					return
+				}
+				if canonical, ok := aliases[f.Name]; ok {
+					f = fs.Lookup(canonical)
+				}
+				if !seen[f.Name] {
+					seen[f.Name] = true
+					candidates = append(candidates, f)
+				}
+			})
+
+			switch len(candidates) {
+			case 0:
+				r = append(r, arg) // unknown flag (the error is reported by pflag)
+				continue
+			case 1:
+				f = candidates[0]
+				arg = "--" + f.Name
+				if len(parts) == 2 {
+					arg += "=" + parts[1]
+				}
+			default:
+				names := make([]string, len(candidates))
+				for j, c := range candidates {
+					names[j] = "--" + c.Name
+				}
+				sort.Strings(names)
+				return nil, fmt.Errorf("ambiguous flag: --%s (candidates: %s)", name, strings.Join(names, ", "))
+			}
+		}
+		r = append(r, arg)
+
+		// the next argument is the value of the flag (e.g. `--name --foo`)
+		if len(parts) == 1 && f.NoOptDefVal == "" && i+1 < len(args) {
+			i++
+			r = append(r, args[i])
+		}
+	}
+	return r, nil
+}
+
+// shorthandNeedsNextArg returns true if the last flag of the shorthands (e.g. "vo" of `-vo`) takes the next argument as its value.
+func shorthandNeedsNextArg(fs *flag.FlagSet, shorthands string) bool {
+	for j := 0; j < len(shorthands); j++ {
+		f := fs.ShorthandLookup(shorthands[j : j+1])
+		if f == nil || strings.HasPrefix(shorthands[j+1:], "=") {
+			return false
+		}
+		if f.NoOptDefVal == "" { // the rest is the value, or the next argument if nothing rest
+			return j == len(shorthands)-1
+		}
+	}
+	return false
+}
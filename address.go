@@ -0,0 +1,75 @@
+package flagstruct
+
+import (
+	"fmt"
+	"net"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// for *net.TCPAddr and *net.UDPAddr, e.g. `--addr 127.0.0.1:8080`
+//
+// the host part is optional (e.g. `:8080` means all interfaces), and the host name is resolved by net.ResolveIPAddr.
+
+var (
+	rTCPAddrPtrType = reflect.TypeOf(&net.TCPAddr{})
+	rUDPAddrPtrType = reflect.TypeOf(&net.UDPAddr{})
+)
+
+type addrValue struct {
+	v reflect.Value // addressable *net.TCPAddr or *net.UDPAddr value
+}
+
+func (v *addrValue) Set(s string) error {
+	ip, port, zone, err := parseAddr(strings.TrimSpace(s))
+	if err != nil {
+		return err
+	}
+	switch v.v.Type() {
+	case rUDPAddrPtrType:
+		v.v.Set(reflect.ValueOf(&net.UDPAddr{IP: ip, Port: port, Zone: zone}))
+	default:
+		v.v.Set(reflect.ValueOf(&net.TCPAddr{IP: ip, Port: port, Zone: zone}))
+	}
+	return nil
+}
+
+func parseAddr(s string) (net.IP, int, string, error) {
+	host, portString, err := net.SplitHostPort(s)
+	if err != nil {
+		return nil, 0, "", err
+	}
+	port, err := strconv.ParseUint(portString, 10, 16)
+	if err != nil {
+		return nil, 0, "", fmt.Errorf("invalid port %q (must be in 0-65535)", portString)
+	}
+	if host == "" { // all interfaces
+		return nil, int(port), "", nil
+	}
+
+	var zone string
+	if i := strings.LastIndex(host, "%"); i >= 0 { // e.g. fe80::1%eth0
+		host, zone = host[:i], host[i+1:]
+	}
+	if ip := net.ParseIP(host); ip != nil {
+		return ip, int(port), zone, nil
+	}
+	addr, err := net.ResolveIPAddr("ip", host)
+	if err != nil {
+		return nil, 0, "", err
+	}
+	return addr.IP, int(port), addr.Zone, nil
+}
+
+func (v *addrValue) String() string {
+	if v.v.IsNil() {
+		return ""
+	}
+	return v.v.Interface().(fmt.Stringer).String()
+}
+
+// for pflag.Value
+func (v *addrValue) Type() string {
+	return "address"
+}
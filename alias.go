@@ -0,0 +1,70 @@
+package flagstruct
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	flag "github.com/spf13/pflag"
+)
+
+// for flag aliases, e.g. `aliases:"deadline,ttl"` (--deadline and --ttl are also available for --timeout)
+//
+// the aliases are registered as hidden flags delegating to the value of the canonical flag,
+// and the canonical flag is marked as changed after parsing if any alias is set. (aliases are not read from envvar)
+
+func (b *Binder) registerAliases(fs *flag.FlagSet, f *flag.Flag, rf reflect.StructField, prefix string, aliases string) {
+	for _, alias := range strings.Split(aliases, ",") {
+		alias = strings.TrimSpace(alias)
+		if alias == "" {
+			continue
+		}
+		name := b.FlagNameFunc(prefix + alias)
+		if b.FlagNameFunc2 != nil {
+			name = b.FlagNameFunc2(prefix, alias)
+		}
+		if fs.Lookup(name) != nil {
+			panic(fmt.Sprintf("alias --%s of --%s (field %s) is already defined", name, f.Name, rf.Name))
+		}
+
+		af := fs.VarPF(&aliasValue{fs: fs, name: f.Name}, name, "", "alias of --"+f.Name)
+		af.NoOptDefVal = f.NoOptDefVal
+		af.Hidden = true
+		if b.State.aliases == nil {
+			b.State.aliases = map[string]string{}
+		}
+		b.State.aliases[af.Name] = f.Name
+	}
+}
+
+// aliasValue delegates to the value of the canonical flag, looked up at each call.
+// (the value of the canonical flag can be wrapped after the alias is registered, e.g. by maxlen)
+type aliasValue struct {
+	fs   *flag.FlagSet
+	name string // the canonical flag name
+}
+
+func (v *aliasValue) value() flag.Value {
+	return v.fs.Lookup(v.name).Value
+}
+
+func (v *aliasValue) String() string {
+	return v.value().String()
+}
+
+func (v *aliasValue) Set(s string) error {
+	return v.value().Set(s)
+}
+
+func (v *aliasValue) Type() string {
+	return v.value().Type()
+}
+
+// syncAliases marks the canonical flags as changed, if their aliases are set.
+func (b *Binder) syncAliases(fs *flag.FlagSet) {
+	for alias, canonical := range b.State.aliases {
+		if af := fs.Lookup(alias); af != nil && af.Changed {
+			fs.Lookup(canonical).Changed = true
+		}
+	}
+}
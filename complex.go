@@ -0,0 +1,35 @@
+package flagstruct
+
+import (
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// for complex64/complex128 (pflag has no support), parsing Go's complex literal (e.g. 1+2i)
+
+type complexValue struct {
+	v reflect.Value // addressable complex value
+}
+
+func (v *complexValue) Set(s string) error {
+	c, err := strconv.ParseComplex(strings.TrimSpace(s), v.bitSize())
+	if err != nil {
+		return err
+	}
+	v.v.SetComplex(c)
+	return nil
+}
+
+func (v *complexValue) String() string {
+	return strconv.FormatComplex(v.v.Complex(), 'g', -1, v.bitSize())
+}
+
+func (v *complexValue) bitSize() int {
+	return v.v.Type().Bits()
+}
+
+// for pflag.Value
+func (v *complexValue) Type() string {
+	return v.v.Kind().String() // complex64 or complex128
+}
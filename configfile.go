@@ -0,0 +1,87 @@
+package flagstruct
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+
+	flag "github.com/spf13/pflag"
+)
+
+// for config file, e.g. `fs.LoadConfig("config.json")`
+//
+// the config file is decoded by Config.ConfigDecoders (chosen by the extension, only JSON is registered by default),
+// and the decoded values are used as the defaults of the flags not set yet.
+
+// LoadConfig reads the config file and updates the defaults of the unset flags, with the decoder chosen by the extension.
+func (fs *FlagSet) LoadConfig(path string) error {
+	ext := strings.ToLower(filepath.Ext(path))
+	decoder, ok := fs.Binder.ConfigDecoders[ext]
+	if !ok {
+		return fmt.Errorf("on config file %s, the decoder for %q is not registered", path, ext)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("on config file %s, %w", path, err)
+	}
+	if err := fs.loadDefaults(data, decoder); err != nil {
+		return fmt.Errorf("on config file %s, %w", path, err)
+	}
+	return nil
+}
+
+// LoadYAMLDefaults reads the YAML file and updates the defaults of the unset flags, with Config.Unmarshaler.
+// (if Config.Unmarshaler is nil, the decoder for ".yaml" in Config.ConfigDecoders is used)
+func (fs *FlagSet) LoadYAMLDefaults(path string) error {
+	unmarshal := fs.Binder.Unmarshaler
+	if unmarshal == nil {
+		unmarshal = fs.Binder.ConfigDecoders[".yaml"]
+	}
+	if unmarshal == nil {
+		return fmt.Errorf("on config file %s, Config.Unmarshaler is not set", path)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("on config file %s, %w", path, err)
+	}
+	if err := fs.loadDefaults(data, unmarshal); err != nil {
+		return fmt.Errorf("on config file %s, %w", path, err)
+	}
+	return nil
+}
+
+func (fs *FlagSet) loadDefaults(data []byte, unmarshal func([]byte, interface{}) error) error {
+	for _, target := range fs.Binder.State.targets {
+		// decoding into the copy, to update only the unset flags
+		tmp := reflect.New(target.Type().Elem())
+		copyValue(tmp.Elem(), target.Elem())
+		tfs, err := fs.buildShadow(tmp.Interface())
+		if err != nil {
+			return err
+		}
+		if err := unmarshal(data, tmp.Interface()); err != nil {
+			return err
+		}
+
+		var retErr error
+		tfs.VisitAll(func(tf *flag.Flag) {
+			f := fs.Lookup(tf.Name)
+			if retErr != nil || f == nil || f.Changed {
+				return
+			}
+			if err := copyFlagValue(f, tf); err != nil {
+				retErr = err
+				return
+			}
+			if _, ok := f.Value.(*negativeBoolValue); !ok {
+				f.DefValue = f.Value.String()
+			}
+		})
+		if retErr != nil {
+			return retErr
+		}
+	}
+	return nil
+}
@@ -0,0 +1,357 @@
+package flagstruct
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+
+	flag "github.com/spf13/pflag"
+)
+
+// for the constraints of the numeric field, validated on Set
+//
+// - choices: `choices:"1,2,4,8"` (for int fields)
+// - oneof: `oneof:"low,medium,high"` (for string fields, with `oneofci:"true"`, matched case-insensitively and stored as the listed casing)
+// - range: `min:"1" max:"65535"` (for int, int64, uint, uint64, float64 fields, either can be omitted)
+// - pattern: `pattern:"^[a-z0-9-]+$"` (for string fields, compiled at build time)
+// - maxlen: `maxlen:"3"` (for slice fields, the number of elements after Set)
+// - minlen: `minlen:"1"` (for slice fields, the number of elements after Parse, like required)
+//
+// and the normalization of the string field, `case:"lower"` or `case:"upper"` (applied before the validation)
+
+type choicesValue struct {
+	flag.Value
+	choices []string // normalized (base 10)
+}
+
+func (v *choicesValue) Set(s string) error {
+	n, err := strconv.ParseInt(strings.TrimSpace(s), 0, 64)
+	if err != nil {
+		return err
+	}
+	x := strconv.FormatInt(n, 10)
+	for _, c := range v.choices {
+		if c == x {
+			return v.Value.Set(s)
+		}
+	}
+	return fmt.Errorf("must be one of %s", strings.Join(v.choices, ", "))
+}
+
+// parseChoices parses the value of choices tag. (panics if the field is not int, or the choice is not integer)
+func parseChoices(rf reflect.StructField, tag string) []string {
+	switch rf.Type.Kind() {
+	case reflect.Int, reflect.Int64, reflect.Uint, reflect.Uint64:
+		if rf.Type == rTimeDurationType {
+			panic(fmt.Sprintf("choices of field %s is not supported for %v", rf.Name, rf.Type))
+		}
+	default:
+		panic(fmt.Sprintf("choices of field %s is not supported for %v", rf.Name, rf.Type))
+	}
+
+	var choices []string
+	for _, c := range strings.Split(tag, ",") {
+		n, err := strconv.ParseInt(strings.TrimSpace(c), 0, 64)
+		if err != nil {
+			panic(fmt.Sprintf("invalid choice %q of field %s, %+v", c, rf.Name, err))
+		}
+		choices = append(choices, strconv.FormatInt(n, 10))
+	}
+	return choices
+}
+
+type oneOfValue struct {
+	flag.Value
+	choices         []string
+	caseInsensitive bool
+}
+
+func (v *oneOfValue) Set(s string) error {
+	for _, c := range v.choices {
+		if c == s || (v.caseInsensitive && strings.EqualFold(c, s)) {
+			return v.Value.Set(c) // canonicalized
+		}
+	}
+	return fmt.Errorf("must be one of %s", strings.Join(v.choices, ", "))
+}
+
+// parseOneOf parses the value of oneof tag. (panics if the field is not string, or no choices)
+func parseOneOf(rf reflect.StructField, tag string) []string {
+	if rf.Type.Kind() != reflect.String {
+		panic(fmt.Sprintf("oneof of field %s is not supported for %v", rf.Name, rf.Type))
+	}
+
+	var choices []string
+	for _, c := range strings.Split(tag, ",") {
+		if c = strings.TrimSpace(c); c != "" {
+			choices = append(choices, c)
+		}
+	}
+	if len(choices) == 0 {
+		panic(fmt.Sprintf("oneof of field %s is empty", rf.Name))
+	}
+	return choices
+}
+
+type rangeValue struct {
+	flag.Value
+	kind     reflect.Kind
+	min, max string // empty is unbounded
+}
+
+func (v *rangeValue) Set(s string) error {
+	s = strings.TrimSpace(s)
+	ok, err := v.inRange(s)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		switch {
+		case v.min != "" && v.max != "":
+			return fmt.Errorf("must be between %s and %s", v.min, v.max)
+		case v.min != "":
+			return fmt.Errorf("must be greater than or equal to %s", v.min)
+		default:
+			return fmt.Errorf("must be less than or equal to %s", v.max)
+		}
+	}
+	return v.Value.Set(s)
+}
+
+func (v *rangeValue) inRange(s string) (bool, error) {
+	switch v.kind {
+	case reflect.Int, reflect.Int64:
+		n, err := strconv.ParseInt(s, 0, 64)
+		if err != nil {
+			return false, err
+		}
+		lo, _ := strconv.ParseInt(v.min, 0, 64)
+		hi, _ := strconv.ParseInt(v.max, 0, 64)
+		return (v.min == "" || lo <= n) && (v.max == "" || n <= hi), nil
+	case reflect.Uint, reflect.Uint64:
+		n, err := strconv.ParseUint(s, 0, 64)
+		if err != nil {
+			return false, err
+		}
+		lo, _ := strconv.ParseUint(v.min, 0, 64)
+		hi, _ := strconv.ParseUint(v.max, 0, 64)
+		return (v.min == "" || lo <= n) && (v.max == "" || n <= hi), nil
+	default: // float64
+		n, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return false, err
+		}
+		lo, _ := strconv.ParseFloat(v.min, 64)
+		hi, _ := strconv.ParseFloat(v.max, 64)
+		return (v.min == "" || lo <= n) && (v.max == "" || n <= hi), nil
+	}
+}
+
+// newRangeValue validates the bounds of min/max tags. (panics if the field is not numeric, or the bound is invalid)
+func newRangeValue(value flag.Value, rf reflect.StructField, minValue, maxValue string) *rangeValue {
+	kind := rf.Type.Kind()
+	switch kind {
+	case reflect.Int, reflect.Int64, reflect.Uint, reflect.Uint64, reflect.Float64:
+		if rf.Type == rTimeDurationType {
+			panic(fmt.Sprintf("min/max of field %s is not supported for %v", rf.Name, rf.Type))
+		}
+	default:
+		panic(fmt.Sprintf("min/max of field %s is not supported for %v", rf.Name, rf.Type))
+	}
+
+	v := &rangeValue{Value: value, kind: kind, min: strings.TrimSpace(minValue), max: strings.TrimSpace(maxValue)}
+	for _, bound := range []string{v.min, v.max} {
+		if bound == "" {
+			continue
+		}
+		if _, err := v.inRange(bound); err != nil {
+			panic(fmt.Sprintf("invalid min/max %q of field %s, %+v", bound, rf.Name, err))
+		}
+	}
+	return v
+}
+
+type patternValue struct {
+	flag.Value
+	rx *regexp.Regexp
+}
+
+func (v *patternValue) Set(s string) error {
+	if !v.rx.MatchString(s) {
+		return fmt.Errorf("must match the pattern %q", v.rx.String())
+	}
+	return v.Value.Set(s)
+}
+
+// newPatternValue compiles the pattern of pattern tag. (panics if the field is not string, or the pattern is invalid)
+func newPatternValue(value flag.Value, rf reflect.StructField, pattern string) *patternValue {
+	if rf.Type.Kind() != reflect.String {
+		panic(fmt.Sprintf("pattern of field %s is not supported for %v", rf.Name, rf.Type))
+	}
+	rx, err := regexp.Compile(pattern)
+	if err != nil {
+		panic(fmt.Sprintf("invalid pattern %q of field %s, %+v", pattern, rf.Name, err))
+	}
+	return &patternValue{Value: value, rx: rx}
+}
+
+type caseValue struct {
+	flag.Value
+	convert func(string) string
+}
+
+func (v *caseValue) Set(s string) error {
+	return v.Value.Set(v.convert(s))
+}
+
+// newCaseValue returns the normalizing value of case tag. (panics if the field is not string, or the case is unknown)
+func newCaseValue(value flag.Value, rf reflect.StructField, c string) *caseValue {
+	if rf.Type.Kind() != reflect.String {
+		panic(fmt.Sprintf("case of field %s is not supported for %v", rf.Name, rf.Type))
+	}
+	switch c {
+	case "lower":
+		return &caseValue{Value: value, convert: strings.ToLower}
+	case "upper":
+		return &caseValue{Value: value, convert: strings.ToUpper}
+	default:
+		panic(fmt.Sprintf("invalid case %q of field %s (lower or upper)", c, rf.Name))
+	}
+}
+
+type maxLenValue struct {
+	flag.Value
+	slice reflect.Value // the bound slice field
+	max   int
+}
+
+func (v *maxLenValue) Set(s string) error {
+	// the copy of the current value, for restoring on error
+	prev := reflect.Zero(v.slice.Type())
+	if !v.slice.IsNil() {
+		prev = reflect.MakeSlice(v.slice.Type(), v.slice.Len(), v.slice.Len())
+		reflect.Copy(prev, v.slice)
+	}
+
+	if err := v.Value.Set(s); err != nil {
+		v.slice.Set(prev)
+		return err
+	}
+	if n := v.slice.Len(); n > v.max {
+		v.slice.Set(prev)
+		return fmt.Errorf("must have at most %d elements, but %d", v.max, n)
+	}
+	return nil
+}
+
+// maxLenSliceValue is the maxLenValue for pflag.SliceValue (e.g. []string, []int), keeping the state of the value.
+type maxLenSliceValue struct {
+	flag.Value
+	slice flag.SliceValue
+	field reflect.Value // the bound slice field (for restoring nil)
+	max   int
+
+	changed    bool // if true, Set appends the value (otherwise, replaces the default value)
+	innerIsSet bool // if true, the wrapped value appends on Set (it has been set, even if rejected)
+}
+
+func (v *maxLenSliceValue) Set(s string) error {
+	prev := v.slice.GetSlice()
+	wasNil := v.field.IsNil()
+	if err := v.Value.Set(s); err != nil {
+		return err
+	}
+	values := v.slice.GetSlice()
+	if !v.changed && v.innerIsSet {
+		values = values[len(prev):] // the wrapped value appended, but the default must be replaced
+	}
+	v.innerIsSet = true
+
+	if n := len(values); n > v.max {
+		if err := v.slice.Replace(prev); err != nil {
+			return err
+		}
+		if wasNil {
+			v.field.Set(reflect.Zero(v.field.Type()))
+		}
+		return fmt.Errorf("must have at most %d elements, but %d", v.max, n)
+	}
+	if err := v.slice.Replace(values); err != nil {
+		return err
+	}
+	v.changed = true
+	return nil
+}
+
+// for pflag.SliceValue
+func (v *maxLenSliceValue) Append(s string) error {
+	if n := len(v.slice.GetSlice()) + 1; n > v.max {
+		return fmt.Errorf("must have at most %d elements, but %d", v.max, n)
+	}
+	return v.slice.Append(s)
+}
+
+// for pflag.SliceValue
+func (v *maxLenSliceValue) Replace(values []string) error {
+	if n := len(values); n > v.max {
+		return fmt.Errorf("must have at most %d elements, but %d", v.max, n)
+	}
+	return v.slice.Replace(values)
+}
+
+// for pflag.SliceValue
+func (v *maxLenSliceValue) GetSlice() []string {
+	return v.slice.GetSlice()
+}
+
+// parseMaxLen parses the value of maxlen tag. (panics if the field is not slice, or the length is invalid)
+func parseMaxLen(rf reflect.StructField, maxlen string) int {
+	if rf.Type.Kind() != reflect.Slice {
+		panic(fmt.Sprintf("maxlen of field %s is not supported for %v", rf.Name, rf.Type))
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(maxlen))
+	if err != nil || n < 0 {
+		panic(fmt.Sprintf("invalid maxlen %q of field %s", maxlen, rf.Name))
+	}
+	return n
+}
+
+// newMaxLenValue parses the value of maxlen tag. (panics if the field is not slice, or the length is invalid)
+func newMaxLenValue(value flag.Value, rf reflect.StructField, fv reflect.Value, maxlen string) flag.Value {
+	n := parseMaxLen(rf, maxlen)
+	if sv, ok := value.(flag.SliceValue); ok {
+		return &maxLenSliceValue{Value: value, slice: sv, field: fv, max: n}
+	}
+	return &maxLenValue{Value: value, slice: fv, max: n}
+}
+
+type minLenField struct {
+	fieldname string
+	slice     reflect.Value // the bound slice field
+	min       int
+}
+
+// newMinLenField parses the value of minlen tag. (panics if the field is not slice, or the length is invalid)
+func newMinLenField(fieldname string, rf reflect.StructField, fv reflect.Value, minlen string) minLenField {
+	if rf.Type.Kind() != reflect.Slice {
+		panic(fmt.Sprintf("minlen of field %s is not supported for %v", rf.Name, rf.Type))
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(minlen))
+	if err != nil || n < 0 {
+		panic(fmt.Sprintf("invalid minlen %q of field %s", minlen, rf.Name))
+	}
+	return minLenField{fieldname: fieldname, slice: fv, min: n}
+}
+
+// checkMinLenFields returns the error, if the slice fields have fewer elements than minlen.
+func (b *Binder) checkMinLenFields() error {
+	var errs []error
+	for _, f := range b.State.minLenFields {
+		if n := f.slice.Len(); n < f.min {
+			errs = append(errs, fmt.Errorf("flag --%s must have at least %d elements, but %d", f.fieldname, f.min, n))
+		}
+	}
+	return newMultiError(errs)
+}
@@ -0,0 +1,89 @@
+package flagstruct
+
+import (
+	"fmt"
+	"reflect"
+
+	flag "github.com/spf13/pflag"
+)
+
+// for dynamic flags, defined at runtime without struct (e.g. plugin-defined flags)
+
+// FieldSpec is the definition of a dynamic flag, see Builder.BuildDynamic.
+type FieldSpec struct {
+	Name      string
+	Type      reflect.Type // if nil, the type of Default is used (e.g. reflect.TypeOf(0) for int)
+	Default   interface{}
+	Help      string
+	Shorthand string
+}
+
+// BuildDynamic builds a FlagSet from the specs. The returned map holds the values by name.
+// (initially the defaults, and refreshed by FlagSet.Parse)
+func (b *Builder) BuildDynamic(schema []FieldSpec) (*FlagSet, map[string]interface{}) {
+	r, err := b.buildWith(flag.NewFlagSet(b.Name, b.HandlingMode), b.Name, func(fs *flag.FlagSet, binder *Binder) {
+		binder.State.dynamicValues = map[string]interface{}{}
+		for _, spec := range schema {
+			binder.defineDynamic(fs, spec)
+		}
+	})
+	if err != nil {
+		panic(err)
+	}
+	return r, r.Binder.State.dynamicValues
+}
+
+func (b *Binder) defineDynamic(fs *flag.FlagSet, spec FieldSpec) {
+	typ := spec.Type
+	if typ == nil {
+		if spec.Default == nil {
+			panic(fmt.Sprintf("the type of dynamic flag --%s is unknown (Type and Default are nil)", spec.Name))
+		}
+		typ = reflect.TypeOf(spec.Default)
+	}
+	fv := reflect.New(typ).Elem()
+	if spec.Default != nil {
+		dv := reflect.ValueOf(spec.Default)
+		if !dv.Type().AssignableTo(typ) {
+			panic(fmt.Sprintf("the default of dynamic flag --%s is %v, but %v is expected", spec.Name, dv.Type(), typ))
+		}
+		fv.Set(dv)
+	}
+	if fs.Lookup(spec.Name) != nil {
+		panic(fmt.Sprintf("flag --%s is already defined", spec.Name))
+	}
+
+	helpText := spec.Help
+	if helpText == "" {
+		helpText = "-"
+	}
+	envName := ""
+	if b.EnvvarSupport {
+		envName = b.EnvNameFunc(spec.Name)
+	}
+
+	fc := fieldcontext{
+		fieldname:   spec.Name,
+		helpText:    b.envHelpText(spec.Name) + helpText,
+		shorthand:   spec.Shorthand,
+		envName:     envName,
+		description: helpText,
+		fieldPath:   spec.Name,
+		hasFlagname: true,
+		field:       reflect.StructField{Name: spec.Name, Type: typ},
+		value:       fv,
+	}
+	b.State.visitedFields = append(b.State.visitedFields, fc)
+	b.walkField(fs, typ, fv, fc)
+	b.State.dynamicValues[spec.Name] = fv.Interface()
+}
+
+// syncDynamicValues refreshes the map returned by BuildDynamic.
+func (b *Binder) syncDynamicValues() {
+	if b.State.dynamicValues == nil {
+		return
+	}
+	for _, fc := range b.State.visitedFields {
+		b.State.dynamicValues[fc.fieldname] = fc.value.Interface()
+	}
+}
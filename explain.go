@@ -0,0 +1,34 @@
+package flagstruct
+
+// Source is the origin of the flag value.
+type Source string
+
+const (
+	SourceDefault     Source = "default"
+	SourceCommandLine Source = "command-line"
+	SourceEnv         Source = "env"
+	SourcePrompt      Source = "prompt"
+	SourceSecret      Source = "secret"
+)
+
+func (b *Binder) recordSource(name string, source Source) {
+	if b.State.sources == nil {
+		b.State.sources = map[string]Source{}
+	}
+	b.State.sources[name] = source
+}
+
+// Explain parses the args and returns where the value of each flag came from.
+// (this is dry-run, the args are parsed with the cloned struct, so the target struct is not modified, see Check)
+func (fs *FlagSet) Explain(args []string) (map[string]Source, error) {
+	shadow, err := fs.dryRun(args)
+	if err != nil {
+		return nil, err
+	}
+
+	r := make(map[string]Source, len(shadow.Binder.State.sources))
+	for name, source := range shadow.Binder.State.sources {
+		r[name] = source
+	}
+	return r, nil
+}
@@ -2,9 +2,14 @@ package flagstruct
 
 import (
 	"encoding"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"os"
+	"path/filepath"
 	"reflect"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
@@ -17,37 +22,169 @@ type HasHelpText interface {
 	HelpText() string
 }
 
-// TODO: map
+// HasAllowedValues is the interface for enum, listing the allowed values (for help and completion).
+type HasAllowedValues interface {
+	AllowedValues() []string
+}
+
+// Validator is the interface for validating the field value (see FlagSet.Validate).
+type Validator interface {
+	Validate() error
+}
+
+// Defaulter is the interface for setting default values, called before building flags.
+// (the nested struct's SetDefaults() is called before the parent's one)
+type Defaulter interface {
+	SetDefaults()
+}
+
+// TODO: map of non-struct values (e.g. map[string]string), only map of struct with string key is supported
 
 type Config struct {
 	HandlingMode flag.ErrorHandling
 
 	EnvvarSupport bool
-	EnvPrefix     string
+	EnvPrefix     string // the prefix of envvar name, joined with "_" (e.g. "APP" and "APP_" are the same)
 	EnvNameFunc   func(string) string
+	EnvHelpFormat string // format of envvar annotation in help text, taking the env name (empty is omitted)
+	EnvTag        string // if the value of this tag is "-", the field is not read from envvar
+
+	EnvListSeparator string // the separator of envvar value for slice flags (default is ","), e.g. ":" for PATH-like envvar
+	StrictEnv        bool   // if true, the envvars with EnvPrefix not corresponding to any flag are error (e.g. for typo)
+
+	DeriveEnvPrefixFromName bool // if true and EnvPrefix is empty, the prefix is derived from the name of FlagSet on each building (e.g. "myapp" -> "MYAPP_"), the Config itself is not modified (only with the default EnvNameFunc)
 
-	FlagnameTags []string
-	FlagNameFunc func(string) string
+	FlagnameTags  []string
+	FlagNameFunc  func(string) string
+	FlagNameFunc2 func(prefix string, name string) string // if set, used instead of FlagNameFunc (prefix is e.g. "db.")
+
+	StripFieldPrefix string // stripped from the Go field name, for the flags named by the field name (e.g. "Server" for ServerHost -> Host)
 
 	ShorthandTag string
 	HelpTextTag  string
 	RequiredTag  string
+	SensitiveTag string
+	ArrayTag     string // if true, the string slice field is not split by comma (StringArray)
+
+	DefaultHelpTag string // the displayed default value in help (the actual default value is not changed)
+	NoArgTag       string // the value used when the flag is set without argument (NoOptDefVal)
+	NegatableTag   string // if true, the hidden negative flag (--no-<name>) is also registered for the bool field
+	LayoutTag      string // the layout of []time.Time field (default is time.RFC3339)
+
+	PassthroughTag string // the []string field with this tag receives the arguments after "--"
+	GlobTag        string // if true, the patterns in the []string field are expanded by filepath.Glob after parsing
+	FromFileTag    string // if true, the value beginning with "@" or "file://" is read from the file (e.g. --token @token.txt)
+	ShortOnlyTag   string // if true, the flag is available only by the shorthand (e.g. -v, but not --verbose)
+	AliasesTag     string // the comma-separated additional flag names (e.g. `aliases:"deadline,ttl"`)
+	SecretRefTag   string // the reference of the secret, resolved by SecretResolver if the flag is not set (e.g. `secretref:"vault:secret/db#password"`)
+	ChoicesTag     string // the comma-separated allowed values of the int field (e.g. `choices:"1,2,4,8"`)
+	OneOfTag       string // the comma-separated allowed values of the string field (e.g. `oneof:"low,medium,high"`)
+	OneOfCITag     string // if true, the value of OneOfTag is matched case-insensitively, and stored as the listed casing
+	MinTag         string // the lower bound of the numeric field (inclusive)
+	MaxTag         string // the upper bound of the numeric field (inclusive)
+	PatternTag     string // the regular expression the value of the string field must match
+	CaseTag        string // "lower" or "upper", the value of the string field is normalized on Set
+	GroupTag       string // the description of the nested struct, used as the group header in grouped usage
+	FlagPrefixTag  string // the prefix of the nested struct's flags, instead of the flag name (empty is flattened, e.g. `flagprefix:""`)
+	MaxLenTag      string // the maximum number of elements of the slice field (e.g. `maxlen:"3"`)
+	MinLenTag      string // the minimum number of elements of the slice field, checked after parsing (e.g. `minlen:"1"`)
+	StdinTag       string // if true, the value "-" is replaced with the content of stdin (see Config.Stdin)
+	InlineTag      string // if "kv", the nested struct is populated from a single flag (e.g. --opts timeout=5s,retries=3)
+	PersistentTag  string // if true, the flag is marked as persistent (see FieldInfo.Persistent, e.g. cobra's PersistentFlags())
+	DeprecatedTag  string // the deprecation message, for the field (or all fields of the nested struct)
+
+	KeepUnmatchedGlob bool // if true, the glob pattern matching nothing is kept as is (see GlobTag)
+
+	MaxDepth int // the limit of nesting depth of struct fields (0 is unlimited)
+
+	IncludeAllExported      bool // if true, the exported fields without flagname tag are also flags (if false, only tagged fields and embedded structs)
+	PanicOnUnexportedTagged bool // if true, panic on the unexported field with flagname tag (if false, it is bound via unsafe pointer)
+
+	ExpandResponseFiles bool // if true, the argument beginning with "@" is expanded with the lines of the file
+	CaseInsensitive     bool // if true, flag names are matched case-insensitively
+	AllowAbbrev         bool // if true, unambiguous abbreviated flag names are accepted (e.g. --verb for --verbose)
+	AllowUnknownFlags   bool // if true, unknown flags are ignored (and can be retrieved by FlagSet.UnknownFlags)
+	AllowSlashFlags     bool // if true, Windows-style flags are accepted (e.g. /name value, /name:value), only for known flag names
+	GroupUsageByStruct  bool // if true, the usage is grouped by the nested struct
+
+	AllowNestedShorthand bool // if true, the shorthand is also available in nested struct fields
+	ShorthandInFlagTag   bool // if true, the second token of the flagname tag is the shorthand (e.g. `flag:"verbose,v"`)
+	AutoShorthand        bool // if true, the first letter of the flag name is used as the shorthand (if not taken)
+	NegatableBools       bool // if true, all bool fields are treated as negatable (see NegatableTag)
+	HideZeroDefaults     bool // if true, the default value annotation in help is omitted if the default is zero value (in FlagSet.FlagUsages and FlagSet.GroupedFlagUsages)
+	HelpTemplates        bool // if true, the help text is rendered as text/template with HelpTemplateData (e.g. {{.Env}})
+	LazyPointerAlloc     bool // if true, the nil pointer field of scalar type is allocated only when the flag is set (the others are allocated eagerly)
+	FlexibleNumbers      bool // if true, int/uint fields accept underscores and base prefixes (e.g. 1_000_000, 0xFF, 0o755, 0b1010)
+	PrefixAnonymous      bool // if true, the embedded struct is prefixed with its type name, instead of flattened (e.g. --Base.verbose)
+
+	Version string // if not empty, --version flag is registered (see Builder.AddVersion)
+
+	MinNArgs int  // the minimum number of the remaining arguments after parsing (see Builder.MinArgs)
+	MaxNArgs *int // the maximum number of the remaining arguments after parsing, nil is unlimited (see Builder.MaxArgs)
+
+	OnFlagRegistered func(f *flag.Flag, field reflect.StructField) // if set, called after each flag is registered (e.g. for MarkHidden, Annotations)
+	HelpTextFunc     func(string) string                           // if set, applied to every help text, before the annotations (e.g. envvar, allowed values)
+
+	InteractivePrompt bool                                  // if true, missing required flags are asked for by PromptFunc
+	PromptFunc        func(field FieldInfo) (string, error) // if nil, reads a line from stdin (only when stdin is a TTY, and the sensitive fields are refused)
+
+	Stdin io.Reader // the reader for the value "-" of the field with StdinTag (if nil, os.Stdin is used)
+
+	SecretResolver func(ref string) (string, error) // resolves the secret reference (see SecretRefTag)
+
+	Unmarshaler    func(data []byte, v interface{}) error            // the decoder of config file (e.g. yaml.Unmarshal), for FlagSet.LoadYAMLDefaults
+	ConfigDecoders map[string]func(data []byte, v interface{}) error // the decoders of config file by extension (e.g. ".json"), for FlagSet.LoadConfig
 }
 
 func DefaultConfig() *Config {
 	c := &Config{
-		FlagnameTags:  []string{"flag"},
-		ShorthandTag:  "short",
-		HelpTextTag:   "help",
-		RequiredTag:   "required",
-		EnvvarSupport: true,
-		HandlingMode:  flag.ExitOnError,
+		FlagnameTags:   []string{"flag"},
+		ShorthandTag:   "short",
+		HelpTextTag:    "help",
+		RequiredTag:    "required",
+		SensitiveTag:   "sensitive",
+		ArrayTag:       "array",
+		DefaultHelpTag: "defaulthelp",
+		NoArgTag:       "noarg",
+		NegatableTag:   "negatable",
+		LayoutTag:      "layout",
+		EnvTag:         "env",
+		PassthroughTag: "passthrough",
+		GlobTag:        "glob",
+		FromFileTag:    "fromfile",
+		ShortOnlyTag:   "shortonly",
+		AliasesTag:     "aliases",
+		SecretRefTag:   "secretref",
+		ChoicesTag:     "choices",
+		OneOfTag:       "oneof",
+		OneOfCITag:     "oneofci",
+		MinTag:         "min",
+		MaxTag:         "max",
+		PatternTag:     "pattern",
+		CaseTag:        "case",
+		GroupTag:       "group",
+		FlagPrefixTag:  "flagprefix",
+		MaxLenTag:      "maxlen",
+		MinLenTag:      "minlen",
+		StdinTag:       "stdin",
+		InlineTag:      "inline",
+		PersistentTag:  "persistent",
+		DeprecatedTag:  "deprecated",
+		EnvvarSupport:  true,
+		EnvHelpFormat:  "ENV: %s\t",
+		HandlingMode:   flag.ExitOnError,
+
+		IncludeAllExported: true,
+		EnvListSeparator:   ",",
+		ConfigDecoders: map[string]func([]byte, interface{}) error{
+			".json": json.Unmarshal,
+		},
 	}
 	if v := os.Getenv("ENV_PREFIX"); v != "" {
 		c.EnvPrefix = v
 	}
 	c.EnvNameFunc = func(name string) string {
-		return c.EnvPrefix + strings.ReplaceAll(strings.ReplaceAll(strings.ToUpper(name), "-", "_"), ".", "_")
+		return c.envPrefix() + strings.ReplaceAll(strings.ReplaceAll(strings.ToUpper(name), "-", "_"), ".", "_")
 	}
 	c.FlagNameFunc = func(v string) string {
 		if strings.Contains(v, ",") {
@@ -58,14 +195,40 @@ func DefaultConfig() *Config {
 	return c
 }
 
+// the code pointer of the EnvNameFunc set by DefaultConfig (the same for all configs, as a closure)
+var defaultEnvNameFuncPointer = reflect.ValueOf(DefaultConfig().EnvNameFunc).Pointer()
+
+// isDefaultEnvNameFunc returns true if fn is the EnvNameFunc set by DefaultConfig. (the user-supplied one may add its own prefix)
+func isDefaultEnvNameFunc(fn func(string) string) bool {
+	return fn != nil && reflect.ValueOf(fn).Pointer() == defaultEnvNameFuncPointer
+}
+
+// envPrefixFromName returns the envvar prefix derived from the program name. (e.g. "/usr/bin/my-app.exe" -> "MY_APP")
+func envPrefixFromName(name string) string {
+	name = filepath.Base(name)
+	name = strings.TrimSuffix(name, filepath.Ext(name))
+	name = strings.ToUpper(strings.NewReplacer("-", "_", ".", "_", " ", "_").Replace(name))
+	return strings.Trim(name, "_")
+}
+
+// envPrefix returns EnvPrefix with the trailing "_" (e.g. "APP" -> "APP_"), or empty string if EnvPrefix is empty.
+func (c *Config) envPrefix() string {
+	if c.EnvPrefix == "" {
+		return ""
+	}
+	return strings.TrimRight(c.EnvPrefix, "_") + "_"
+}
+
 var (
 	rTimeDurationType    reflect.Type
+	rTimeType            reflect.Type
 	rFlagValueType       reflect.Type
 	rTextUnmarshalerType reflect.Type
 )
 
 func init() {
 	rTimeDurationType = reflect.TypeOf(time.Second)
+	rTimeType = reflect.TypeOf(time.Time{})
 	rFlagValueType = reflect.TypeOf(func() flag.Value { return nil }).Out(0)
 	rTextUnmarshalerType = reflect.TypeOf(func() encoding.TextUnmarshaler { return nil }).Out(0)
 }
@@ -81,36 +244,301 @@ func NewBuilder() *Builder {
 	return b
 }
 
+// AddVersion registers the --version flag, that prints the version (to the output of FlagSet, or stdout if not set) and exits.
+// (under ContinueOnError, Parse returns ErrVersion instead of exiting)
+func (b *Builder) AddVersion(version string) {
+	b.Version = version
+}
+
+// MinArgs sets the minimum number of the remaining arguments (fs.Args()), checked in Parse.
+// (the arguments after `--` are not counted, if the passthrough field exists)
+func (b *Builder) MinArgs(n int) {
+	b.MinNArgs = n
+}
+
+// MaxArgs sets the maximum number of the remaining arguments (fs.Args()), checked in Parse.
+// (the arguments after `--` are not counted, if the passthrough field exists)
+func (b *Builder) MaxArgs(n int) {
+	b.MaxNArgs = &n
+}
+
+// Build builds a FlagSet from the struct (pointer). It panics on error, same as MustBuild.
 func (b *Builder) Build(o interface{}) *FlagSet {
-	rt := reflect.TypeOf(o)
-	rv := reflect.ValueOf(o)
+	return b.MustBuild(o)
+}
 
-	if rt.Kind() != reflect.Ptr {
-		panic(fmt.Sprintf("%v is not pointer of struct", rt)) // for canAddr
+// MustBuild is like BuildE, but panics on error. (e.g. shorthand collision, unsupported type)
+func (b *Builder) MustBuild(o interface{}) *FlagSet {
+	fs, err := b.BuildE(o)
+	if err != nil {
+		panic(err)
 	}
-	rt = rt.Elem()
-	rv = rv.Elem()
+	return fs
+}
+
+// BuildNamed is like Build, but uses the name instead of Builder.Name. (the builder is not modified)
+func (b *Builder) BuildNamed(name string, o interface{}) *FlagSet {
+	nb := *b
+	nb.Name = name
+	return nb.Build(o)
+}
 
+// BuildMany builds a FlagSet from multiple structs. (the flag names must not collide across them)
+func (b *Builder) BuildMany(obs ...interface{}) *FlagSet {
+	fs, err := b.buildMany(obs...)
+	if err != nil {
+		panic(err)
+	}
+	return fs
+}
+
+func (b *Builder) buildMany(obs ...interface{}) (*FlagSet, error) {
+	for _, o := range obs {
+		checkTarget(o)
+	}
+	name := b.Name
+	if name == "" && len(obs) > 0 {
+		name = reflect.TypeOf(obs[0]).Elem().Name()
+	}
+	return b.buildInto(flag.NewFlagSet(name, b.HandlingMode), name, obs...)
+}
+
+// BuildInto is like Build, but the flags are added to the existing FlagSet (e.g. cobra's cmd.Flags()), instead of creating a new one.
+// (the flags already registered in fs are kept, and the flag names must not collide with them)
+func (b *Builder) BuildInto(fs *flag.FlagSet, o interface{}) *FlagSet {
+	checkTarget(o)
 	name := b.Name
 	if name == "" {
-		name = rt.Name()
+		name = reflect.TypeOf(o).Elem().Name()
+	}
+	r, err := b.buildInto(fs, name, o)
+	if err != nil {
+		panic(err)
+	}
+	return r
+}
+
+// buildInto builds the FlagSet, returning the error found in walking the structs. (e.g. too deep nesting)
+func (b *Builder) buildInto(fs *flag.FlagSet, name string, obs ...interface{}) (*FlagSet, error) {
+	return b.buildWith(fs, name, func(fs *flag.FlagSet, binder *Binder) {
+		for _, o := range obs {
+			rv := reflect.ValueOf(o).Elem()
+			binder.State.targets = append(binder.State.targets, reflect.ValueOf(o))
+			binder.setDefaults(rv)
+			binder.walk(fs, rv.Type(), rv, "", "", 0, "")
+		}
+	})
+}
+
+// buildWith builds the FlagSet with the settings shared by all Build* methods (e.g. envvar prefix, --version, usage),
+// and the flags are registered by define.
+func (b *Builder) buildWith(fs *flag.FlagSet, name string, define func(*flag.FlagSet, *Binder)) (*FlagSet, error) {
+	// for envvar prefix (e.g. MYAPP_TIMEOUT)
+	config := b.Config
+	if b.DeriveEnvPrefixFromName && b.EnvPrefix == "" && isDefaultEnvNameFunc(b.EnvNameFunc) {
+		if prefix := envPrefixFromName(name); prefix != "" {
+			// the per-build copy, not to modify the Config shared with the Builder
+			c := *b.Config
+			c.EnvPrefix = prefix
+			envNameFunc := b.EnvNameFunc // sees the empty prefix of the Builder's Config
+			c.EnvNameFunc = func(name string) string {
+				return c.envPrefix() + envNameFunc(name)
+			}
+			config = &c
+		}
 	}
-	fs := flag.NewFlagSet(name, b.HandlingMode)
 
-	binder := &Binder{Config: b.Config}
+	if b.AllowUnknownFlags {
+		fs.ParseErrorsWhitelist.UnknownFlags = true
+	}
+	if b.CaseInsensitive {
+		fs.SetNormalizeFunc(func(f *flag.FlagSet, name string) flag.NormalizedName {
+			return flag.NormalizedName(strings.ToLower(name))
+		})
+	}
+
+	binder := &Binder{Config: config}
+	binder.State.name = name
 	binder.State.toplevelStructMap = map[reflect.Type]reflect.Value{}
 	binder.State.embeddedStructPointerMap = map[reflect.Type][]reflect.Value{}
 
-	binder.walk(fs, rt, rv, "")
+	define(fs, binder)
+	if binder.State.err != nil {
+		return nil, binder.State.err
+	}
+
+	// for --version
+	if b.Version != "" {
+		fs.BoolVar(&binder.State.versionRequested, "version", false, "show version")
+	}
+
+	r := &FlagSet{FlagSet: fs, Binder: binder}
+	if b.GroupUsageByStruct {
+		fs.Usage = func() {
+			fmt.Fprintf(r.Output(), "Usage of %s:\n", name)
+			fmt.Fprint(r.Output(), r.GroupedFlagUsages())
+		}
+	} else if len(binder.State.zeroDefaults) > 0 {
+		fs.Usage = func() {
+			fmt.Fprintf(r.Output(), "Usage of %s:\n", name)
+			fmt.Fprint(r.Output(), r.FlagUsages())
+		}
+	}
+	return r, nil
+}
+
+// BuildWithDefaults is like Build, but the default values are read from defaults (the same type struct, or its pointer), instead of o.
+// (defaults is deep-copied into o, so parsing never modifies defaults)
+func (b *Builder) BuildWithDefaults(o interface{}, defaults interface{}) *FlagSet {
+	checkTarget(o)
+	rt := reflect.TypeOf(o)
+	dv := reflect.ValueOf(defaults)
+	if dv.Kind() == reflect.Ptr {
+		dv = dv.Elem()
+	} else { // addressable, for unexported fields
+		ptr := reflect.New(dv.Type())
+		ptr.Elem().Set(dv)
+		dv = ptr.Elem()
+	}
+	if dv.Type() != rt.Elem() {
+		panic(fmt.Sprintf("defaults type does not match: %v != %v", dv.Type(), rt.Elem()))
+	}
+	copyValue(reflect.ValueOf(o).Elem(), dv)
+	return b.Build(o)
+}
+
+// copyValue copies src to dst, allocating the pointers and slices (not shared with src).
+func copyValue(dst, src reflect.Value) {
+	switch src.Kind() {
+	case reflect.Ptr:
+		if src.IsNil() {
+			return
+		}
+		v := reflect.New(src.Type().Elem())
+		copyValue(v.Elem(), src.Elem())
+		dst.Set(v)
+	case reflect.Struct:
+		for i := 0; i < src.NumField(); i++ {
+			df := dst.Field(i)
+			if !df.CanSet() { // for unexported field
+				df = reflect.NewAt(df.Type(), unsafe.Pointer(df.UnsafeAddr())).Elem()
+			}
+			sf := src.Field(i)
+			if !sf.CanInterface() && sf.CanAddr() {
+				sf = reflect.NewAt(sf.Type(), unsafe.Pointer(sf.UnsafeAddr())).Elem()
+			}
+			copyValue(df, sf)
+		}
+	case reflect.Slice:
+		if src.IsNil() {
+			return
+		}
+		v := reflect.MakeSlice(src.Type(), src.Len(), src.Len())
+		for i := 0; i < src.Len(); i++ {
+			copyValue(v.Index(i), src.Index(i))
+		}
+		dst.Set(v)
+	case reflect.Map:
+		if src.IsNil() {
+			return
+		}
+		v := reflect.MakeMapWithSize(src.Type(), src.Len())
+		iter := src.MapRange()
+		for iter.Next() {
+			ev := reflect.New(src.Type().Elem()).Elem()
+			copyValue(ev, iter.Value())
+			v.SetMapIndex(iter.Key(), ev)
+		}
+		dst.Set(v)
+	default:
+		dst.Set(src)
+	}
+}
+
+// BuildE is like Build, but returns an error instead of panic. (e.g. shorthand collision, unsupported type)
+func (b *Builder) BuildE(o interface{}) (fs *FlagSet, retErr error) {
+	defer func() {
+		if r := recover(); r != nil {
+			switch r := r.(type) {
+			case error:
+				retErr = r
+			case string:
+				retErr = errors.New(r)
+			default:
+				panic(r)
+			}
+		}
+	}()
+	return b.buildMany(o)
+}
+
+// BuildValue is like Build, but accepts a struct value. The value is copied to a newly allocated struct,
+// and the pointer of it is returned with the FlagSet. (if o is a pointer, it is used as is)
+func (b *Builder) BuildValue(o interface{}) (*FlagSet, interface{}) {
+	rv := reflect.ValueOf(o)
+	if rv.Kind() == reflect.Ptr {
+		return b.Build(o), o
+	}
+
+	ptr := reflect.New(rv.Type())
+	ptr.Elem().Set(rv)
+	ob := ptr.Interface()
+	return b.Build(ob), ob
+}
+
+// Run builds a FlagSet from the struct (pointer), and parses os.Args[1:]. (a shorthand of Build and Parse, for simple tools)
+// The error handling is always ContinueOnError, so the error is returned, instead of exiting.
+// (flag.ErrHelp for --help, ErrVersion for --version)
+func (b *Builder) Run(o interface{}) error {
+	c := *b.Config
+	c.HandlingMode = flag.ContinueOnError
+	nb := &Builder{Name: b.Name, Config: &c}
+
+	fs, err := nb.BuildE(o)
+	if err != nil {
+		return err
+	}
+	return fs.Parse(os.Args[1:])
+}
 
-	return &FlagSet{FlagSet: fs, Binder: binder}
+// checkTarget panics if o is not a (non-nil) pointer of struct.
+func checkTarget(o interface{}) {
+	rt := reflect.TypeOf(o)
+	switch {
+	case rt == nil:
+		panic("nil is passed, but pointer of struct is required")
+	case rt.Kind() != reflect.Ptr:
+		panic(fmt.Sprintf("%v is not pointer of struct", rt)) // for canAddr
+	case rt.Elem().Kind() != reflect.Struct:
+		panic(fmt.Sprintf("%v is pointer of non-struct, but pointer of struct is required", rt))
+	case reflect.ValueOf(o).IsNil():
+		panic(fmt.Sprintf("%v is nil pointer, but pointer of struct is required", rt))
+	}
 }
 
 type Binder struct {
 	*Config
 
 	State struct {
-		visitedFields []fieldcontext
+		visitedFields     []fieldcontext
+		structSliceFields []structSliceField
+		structMapFields   []structMapField
+		unknownFlags      []string
+		passthroughFields []reflect.Value
+		globFields        []reflect.Value
+		versionRequested  bool
+		sources           map[string]Source
+		targets           []reflect.Value // the pointers of the bound structs
+		terminators       map[string]TerminateFunc
+		dynamicValues     map[string]interface{} // for BuildDynamic
+		name              string                 // the name of the FlagSet (pflag.FlagSet doesn't expose it)
+		shortOnly         map[string]bool
+		aliases           map[string]string // alias -> canonical flag name
+		secretRefs        []secretRef
+		stdinConsumer     string // the flag name which has read stdin (stdin can be read only once)
+		minLenFields      []minLenField
+		err               error           // the error found in walk (returned by BuildE)
+		zeroDefaults      map[string]bool // the flags whose zero default value is omitted in help (for HideZeroDefaults)
 
 		toplevelStructMap        map[reflect.Type]reflect.Value
 		embeddedStructPointerMap map[reflect.Type][]reflect.Value
@@ -118,19 +546,21 @@ type Binder struct {
 }
 
 func (b *Binder) Bind(fs *flag.FlagSet, o interface{}) func(*flag.FlagSet) error {
+	checkTarget(o)
 	rt := reflect.TypeOf(o)
 	rv := reflect.ValueOf(o)
-
-	if rt.Kind() != reflect.Ptr {
-		panic(fmt.Sprintf("%v is not pointer of struct", rt)) // for canAddr
-	}
 	rt = rt.Elem()
 	rv = rv.Elem()
 
 	b.State.toplevelStructMap = map[reflect.Type]reflect.Value{}
 	b.State.embeddedStructPointerMap = map[reflect.Type][]reflect.Value{}
+	b.State.targets = append(b.State.targets, reflect.ValueOf(o))
 
-	b.walk(fs, rt, rv, "")
+	b.setDefaults(rv)
+	b.walk(fs, rt, rv, "", "", 0, "")
+	if err := b.State.err; err != nil {
+		return func(*flag.FlagSet) error { return err }
+	}
 
 	// for shared common option
 	if len(b.State.embeddedStructPointerMap) > 0 {
@@ -142,17 +572,95 @@ func (b *Binder) Bind(fs *flag.FlagSet, o interface{}) func(*flag.FlagSet) error
 }
 
 func (b *Binder) setByEnvvars(fs *flag.FlagSet) (retErr error) {
+	if b.StrictEnv {
+		if err := b.checkUnknownEnvvars(fs); err != nil {
+			return err
+		}
+	}
+
+	normalize := fs.GetNormalizeFunc()
+	noEnv := map[string]bool{}
+	sensitive := map[string]bool{}
+	for _, fc := range b.State.visitedFields {
+		name := string(normalize(fs, fc.fieldname))
+		if fc.noEnv {
+			noEnv[name] = true
+		}
+		if fc.sensitive {
+			sensitive[name] = true
+		}
+	}
+
 	fs.VisitAll(func(f *flag.Flag) {
+		if retErr != nil || noEnv[f.Name] {
+			return
+		}
+		if _, ok := b.State.aliases[f.Name]; ok {
+			return
+		}
 		envname := b.EnvNameFunc(f.Name)
+		if envname == "" {
+			return
+		}
 		if v, ok := os.LookupEnv(envname); ok {
+			if sep := b.EnvListSeparator; sep != "" && sep != "," && isSliceFlag(f) {
+				for _, x := range strings.Split(v, sep) {
+					if err := fs.Set(f.Name, x); err != nil {
+						retErr = fmt.Errorf("on envvar %s=%q, %+v", envname, v, err)
+						return
+					}
+				}
+				b.recordSource(f.Name, SourceEnv)
+				return
+			}
 			if err := fs.Set(f.Name, v); err != nil {
-				retErr = fmt.Errorf("on envvar %s=%v, %+v", envname, v, err)
+				if sensitive[f.Name] { // not to leak the value via the error message
+					retErr = fmt.Errorf("on envvar %s, invalid argument for %q flag", envname, "--"+f.Name)
+					return
+				}
+				retErr = fmt.Errorf("on envvar %s=%q, %+v", envname, v, err)
+				return
 			}
+			b.recordSource(f.Name, SourceEnv)
 		}
 	})
 	return retErr
 }
 
+// checkUnknownEnvvars returns an error, if there are envvars with EnvPrefix not corresponding to any flag.
+// (if EnvPrefix is empty, nothing is checked)
+func (b *Binder) checkUnknownEnvvars(fs *flag.FlagSet) error {
+	if b.EnvPrefix == "" {
+		return nil
+	}
+	known := map[string]bool{}
+	fs.VisitAll(func(f *flag.Flag) {
+		known[b.EnvNameFunc(f.Name)] = true
+	})
+
+	var unknown []string
+	for _, kv := range os.Environ() {
+		name := strings.SplitN(kv, "=", 2)[0]
+		if strings.HasPrefix(name, b.envPrefix()) && !known[name] {
+			unknown = append(unknown, name)
+		}
+	}
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+		return fmt.Errorf("unknown envvar(s) with prefix %q: %s", b.EnvPrefix, strings.Join(unknown, ", "))
+	}
+	return nil
+}
+
+// isSliceFlag returns true if the flag accepts multiple values (e.g. --tag x --tag y)
+func isSliceFlag(f *flag.Flag) bool {
+	if _, ok := f.Value.(flag.SliceValue); ok {
+		return true
+	}
+	typ := f.Value.Type()
+	return strings.HasSuffix(typ, "Slice") || strings.HasSuffix(typ, "Array")
+}
+
 func (b *Binder) setSharedCommonEmbeddedStruct() error {
 	for ft, fvs := range b.State.embeddedStructPointerMap {
 		base, ok := b.State.toplevelStructMap[ft.Elem()]
@@ -176,37 +684,73 @@ func (b *Binder) AllRequiredFlagNames() []string {
 	return required
 }
 
+func (b *Binder) AllSensitiveFlagNames() []string {
+	var sensitive []string
+	for _, fc := range b.State.visitedFields {
+		if fc.sensitive {
+			sensitive = append(sensitive, fc.fieldname)
+		}
+	}
+	return sensitive
+}
+
+// AllFields returns the information of the visited fields.
+func (b *Binder) AllFields() []FieldInfo {
+	r := make([]FieldInfo, len(b.State.visitedFields))
+	for i, fc := range b.State.visitedFields {
+		r[i] = fc.info()
+	}
+	return r
+}
+
 func (b *Binder) ValidateRequiredFlags(fs *flag.FlagSet) error {
+	var errs []error
 	for _, requiredName := range b.AllRequiredFlagNames() {
 		if !fs.Lookup(requiredName).Changed {
-			return fmt.Errorf("required flag(s) %q not set", requiredName)
+			errs = append(errs, fmt.Errorf("required flag(s) %q not set", requiredName))
 		}
 	}
-	return nil
+	return newMultiError(errs)
 }
 
-func (b *Binder) walk(fs *flag.FlagSet, rt reflect.Type, rv reflect.Value, prefix string) {
+func (b *Binder) walk(fs *flag.FlagSet, rt reflect.Type, rv reflect.Value, prefix string, pathPrefix string, depth int, deprecated string) {
+	if b.MaxDepth > 0 && depth > b.MaxDepth {
+		if b.State.err == nil {
+			b.State.err = fmt.Errorf("nesting depth of %v is too deep (prefix=%q, max depth=%d)", rt, prefix, b.MaxDepth)
+		}
+		return
+	}
+
+	// for auto shorthand, the explicit shorthands of the sibling fields are reserved
+	var reserved map[string]bool
+	if b.AutoShorthand {
+		reserved = map[string]bool{}
+		for i := 0; i < rt.NumField(); i++ {
+			if v, ok := b.lookupShorthand(rt.Field(i)); ok {
+				reserved[v] = true
+			}
+		}
+	}
+
 	for i := 0; i < rt.NumField(); i++ {
 		rf := rt.Field(i)
 		fv := rv.Field(i)
 
-		fieldname := rf.Name
-		hasFlagname := false
-
-		{
-			for j := len(b.FlagnameTags) - 1; j >= 0; j-- {
-				if v, ok := rf.Tag.Lookup(b.FlagnameTags[j]); ok {
-					fieldname = v
-					hasFlagname = true
-				}
-			}
-			if fieldname == "-" {
-				continue
+		// for passthrough (the arguments after "--")
+		if ok, _ := strconv.ParseBool(rf.Tag.Get(b.PassthroughTag)); ok {
+			if rf.Type != reflect.TypeOf([]string{}) {
+				panic(fmt.Sprintf("passthrough field %s must be []string, but %v", rf.Name, rf.Type))
 			}
-			if !hasFlagname && !rf.IsExported() {
-				continue
-			}
-			fieldname = b.FlagNameFunc(prefix + fieldname)
+			b.State.passthroughFields = append(b.State.passthroughFields, fv)
+			continue
+		}
+
+		fieldname, hasFlagname, skip := b.lookupFlagname(rf, prefix)
+		if skip {
+			continue
+		}
+		if f := fs.Lookup(fieldname); f != nil {
+			panic(fmt.Sprintf("flag --%s (field %s) is already defined", fieldname, rf.Name))
 		}
 
 		helpText := "-"
@@ -221,102 +765,604 @@ func (b *Binder) walk(fs *flag.FlagSet, rt reflect.Type, rv reflect.Value, prefi
 				}
 			}
 		}
+		if b.HelpTextFunc != nil && helpText != "-" {
+			helpText = b.HelpTextFunc(helpText)
+		}
+		description := helpText
+
+		// for enum, for completion
+		var allowedValues []string
+		if fv.CanInterface() && !(fv.Kind() == reflect.Ptr && fv.IsNil()) {
+			impl, ok := fv.Interface().(HasAllowedValues)
+			if !ok && fv.CanAddr() {
+				impl, ok = fv.Addr().Interface().(HasAllowedValues)
+			}
+			if ok {
+				allowedValues = impl.AllowedValues()
+				helpText = helpText + fmt.Sprintf(" (allowed: %s)", strings.Join(allowedValues, ", "))
+			}
+		}
+
+		// for choices of int field (e.g. block size)
+		var choices []string
+		if v, ok := rf.Tag.Lookup(b.ChoicesTag); ok {
+			choices = parseChoices(rf, v)
+			allowedValues = choices
+			helpText = helpText + fmt.Sprintf(" (allowed: %s)", strings.Join(choices, ", "))
+		}
+
+		// for allowed values of string field (e.g. priority)
+		var oneOf []string
+		if v, ok := rf.Tag.Lookup(b.OneOfTag); ok {
+			oneOf = parseOneOf(rf, v)
+			allowedValues = oneOf
+			helpText = helpText + fmt.Sprintf(" (allowed: %s)", strings.Join(oneOf, ", "))
+		}
 
 		required := false
 		if ok, _ := strconv.ParseBool(rf.Tag.Get(b.RequiredTag)); ok {
 			required = true
 		}
+		sensitive := false
+		if ok, _ := strconv.ParseBool(rf.Tag.Get(b.SensitiveTag)); ok {
+			sensitive = true
+		}
 		if required {
 			helpText = helpText + " [required]"
 		}
 
-		if b.EnvvarSupport {
-			helpText = fmt.Sprintf("ENV: %s\t", b.EnvNameFunc(fieldname)) + helpText
+		noEnv := rf.Tag.Get(b.EnvTag) == "-"
+		envName := ""
+		if !noEnv {
+			helpText = b.envHelpText(fieldname) + helpText
+			if b.EnvvarSupport {
+				envName = b.EnvNameFunc(fieldname)
+			}
 		}
 
 		shorthand := ""
-		if v, ok := rf.Tag.Lookup(b.ShorthandTag); ok {
-			if prefix == "" {
+		if v, ok := b.lookupShorthand(rf); ok {
+			if prefix == "" || b.AllowNestedShorthand {
 				shorthand = v
 			}
+		} else if b.AutoShorthand && (prefix == "" || b.AllowNestedShorthand) {
+			shorthand = b.autoShorthand(fs, strings.TrimPrefix(fieldname, prefix), reserved)
+		}
+		if len(shorthand) == 1 {
+			if other := fs.ShorthandLookup(shorthand); other != nil {
+				otherName := other.Name
+				for _, fc := range b.State.visitedFields {
+					if fc.fieldname == other.Name {
+						otherName = fmt.Sprintf("%s (field %s)", other.Name, fc.field.Name)
+						break
+					}
+				}
+				panic(fmt.Sprintf("shorthand %q of --%s (field %s) is already used for --%s", shorthand, fieldname, rf.Name, otherName))
+			}
 		}
 
+		persistent, _ := strconv.ParseBool(rf.Tag.Get(b.PersistentTag))
+		deprecated := deprecated // inherited from the parent struct
+		if v, ok := rf.Tag.Lookup(b.DeprecatedTag); ok && v != "" {
+			deprecated = v
+		}
 		fc := fieldcontext{
 			fieldname: fieldname,
 			helpText:  helpText,
 			required:  required,
+			sensitive: sensitive,
+			noEnv:     noEnv,
+			envName:   envName,
 			shorthand: shorthand,
 
+			allowedValues: allowedValues,
+			description:   description,
+			group:         rf.Tag.Get(b.GroupTag),
+			persistent:    persistent,
+			deprecated:    deprecated,
+
 			prefix:      prefix,
+			fieldPath:   pathPrefix + rf.Name,
+			depth:       depth,
 			hasFlagname: hasFlagname,
 			field:       rf,
+			value:       fv,
+		}
+
+		// for glob expansion
+		if ok, _ := strconv.ParseBool(rf.Tag.Get(b.GlobTag)); ok {
+			if !isGlobFieldType(rf.Type) {
+				panic(fmt.Sprintf("glob field %s must be []string, but %v", rf.Name, rf.Type))
+			}
+			b.State.globFields = append(b.State.globFields, fv)
 		}
 
+		index := len(b.State.visitedFields)
 		b.State.visitedFields = append(b.State.visitedFields, fc)
 		b.walkField(fs, rf.Type, fv, fc)
-	}
-}
-
-type fieldcontext struct {
-	fieldname string
-	helpText  string
-	shorthand string
-	required  bool
 
-	prefix      string
-	hasFlagname bool
-	field       reflect.StructField
-}
+		// for deprecated flag (or the flags of deprecated nested struct)
+		if deprecated != "" {
+			if f := fs.Lookup(fieldname); f != nil {
+				fs.MarkDeprecated(fieldname, deprecated)
+			}
+		}
 
-func (b *Binder) walkField(fs *flag.FlagSet, rt reflect.Type, fv reflect.Value, c fieldcontext) {
-	// for enum (TODO: skip check with cache)
-	{
-		fv := fv
-		ft := fv.Type()
-		isPtr := ft.Kind() == reflect.Ptr
+		// for named scalar type with String() (e.g. enum over ints), displaying the default value with it
+		if isStringerScalar(fv) {
+			if f := fs.Lookup(fieldname); f != nil {
+				f.DefValue = fv.Interface().(fmt.Stringer).String()
+			}
+		}
 
-		// Set() is pointer receiver only
-		if !isPtr {
-			fv = fv.Addr()
-			ft = reflect.PtrTo(ft)
+		// for sensitive flag, masking the default value in help
+		if sensitive && !fv.IsZero() {
+			if f := fs.Lookup(fieldname); f != nil {
+				f.DefValue = SensitiveMask
+			}
 		}
 
-		if ft.Implements(rFlagValueType) {
-			fs.VarP(fv.Interface().(flag.Value), c.fieldname, c.shorthand, c.helpText)
-			return
+		// for overriding the default value display in help
+		if v, ok := rf.Tag.Lookup(b.DefaultHelpTag); ok {
+			if f := fs.Lookup(fieldname); f != nil {
+				f.DefValue = v
+			}
 		}
 
-		if ft.Implements(rTextUnmarshalerType) {
-			if fv.IsNil() && fv.CanAddr() {
-				// flagname is not found, will be skipped (even if the field is a pointer, with field tag, it will be treated as a flag forcely).
-				if !c.hasFlagname {
-					return
+		// for hiding zero default value in help (only recorded here, omitted in FlagSet.FlagUsages)
+		if _, ok := rf.Tag.Lookup(b.DefaultHelpTag); b.HideZeroDefaults && fv.IsZero() && !ok {
+			// pflag hides the zero value of its own types, but not of the others (e.g. []float64, time.Time, complex128)
+			if f := fs.Lookup(fieldname); f != nil && showsDefault(f) {
+				if b.State.zeroDefaults == nil {
+					b.State.zeroDefaults = map[string]bool{}
 				}
-				fv.Set(reflect.New(rt.Elem()))
+				b.State.zeroDefaults[f.Name] = true
 			}
+		}
 
-			ref := fv.Interface().(interface {
-				encoding.TextMarshaler
-				encoding.TextUnmarshaler
-			})
-			fs.VarP(newTextValue(ref, ref, isPtr), c.fieldname, c.shorthand, c.helpText)
-			return
+		if len(choices) > 0 {
+			if f := fs.Lookup(fieldname); f != nil {
+				f.Value = &choicesValue{Value: f.Value, choices: choices}
+			}
+		}
+		if len(oneOf) > 0 {
+			if f := fs.Lookup(fieldname); f != nil {
+				ci, _ := strconv.ParseBool(rf.Tag.Get(b.OneOfCITag))
+				f.Value = &oneOfValue{Value: f.Value, choices: oneOf, caseInsensitive: ci}
+			}
 		}
-	}
 
-	switch rt.Kind() {
-	case reflect.Ptr:
-		if fv.IsNil() && fv.CanAddr() {
-			// flagname is not found, will be skipped (even if the field is a pointer, with field tag, it will be treated as a flag forcely).
+		// for range of numeric field (e.g. port)
+		if minValue, maxValue := rf.Tag.Get(b.MinTag), rf.Tag.Get(b.MaxTag); minValue != "" || maxValue != "" {
+			if f := fs.Lookup(fieldname); f != nil {
+				f.Value = newRangeValue(f.Value, rf, minValue, maxValue)
+			}
+		}
+
+		// for maximum length of slice field (e.g. --tag at most 3 times)
+		if v, ok := rf.Tag.Lookup(b.MaxLenTag); ok {
+			if f := fs.Lookup(fieldname); f != nil {
+				f.Value = newMaxLenValue(f.Value, rf, fv, v)
+			}
+		}
+
+		// for minimum length of slice field (checked in Parse)
+		if v, ok := rf.Tag.Lookup(b.MinLenTag); ok {
+			b.State.minLenFields = append(b.State.minLenFields, newMinLenField(fieldname, rf, fv, v))
+		}
+
+		// for pattern of string field (e.g. resource name)
+		if v, ok := rf.Tag.Lookup(b.PatternTag); ok {
+			if f := fs.Lookup(fieldname); f != nil {
+				f.Value = newPatternValue(f.Value, rf, v)
+			}
+		}
+
+		// for case normalization of string field (wrapping the validations, to be applied first)
+		if v, ok := rf.Tag.Lookup(b.CaseTag); ok {
+			if f := fs.Lookup(fieldname); f != nil {
+				f.Value = newCaseValue(f.Value, rf, v)
+			}
+		}
+
+		// for secret reference (resolved in Parse)
+		if v, ok := rf.Tag.Lookup(b.SecretRefTag); ok && v != "" {
+			b.State.secretRefs = append(b.State.secretRefs, secretRef{fieldname: fieldname, ref: v})
+		}
+
+		// for shorthand-only flag (e.g. -v)
+		if ok, _ := strconv.ParseBool(rf.Tag.Get(b.ShortOnlyTag)); ok {
+			f := fs.Lookup(fieldname)
+			if f == nil || f.Shorthand == "" {
+				panic(fmt.Sprintf("shorthand-only field %s must have the shorthand", rf.Name))
+			}
+			f.Hidden = true
+			if b.State.shortOnly == nil {
+				b.State.shortOnly = map[string]bool{}
+			}
+			b.State.shortOnly[f.Name] = true
+		}
+
+		// for reading the value from a file (e.g. --token @token.txt)
+		if ok, _ := strconv.ParseBool(rf.Tag.Get(b.FromFileTag)); ok {
+			if f := fs.Lookup(fieldname); f != nil {
+				f.Value = &fromFileValue{Value: f.Value}
+			}
+		}
+
+		// for reading the value from stdin (e.g. --body -)
+		if ok, _ := strconv.ParseBool(rf.Tag.Get(b.StdinTag)); ok {
+			if f := fs.Lookup(fieldname); f != nil {
+				f.Value = &stdinValue{Value: f.Value, name: f.Name, binder: b}
+			}
+		}
+
+		// for optional-argument flag (e.g. --color means --color=auto)
+		if v, ok := rf.Tag.Lookup(b.NoArgTag); ok {
+			if f := fs.Lookup(fieldname); f != nil {
+				f.NoOptDefVal = v
+			}
+		}
+
+		// for help text template (e.g. {{.Default}}, {{.Env}})
+		if b.HelpTemplates {
+			if f := fs.Lookup(fieldname); f != nil {
+				data := HelpTemplateData{Name: fieldname, Default: f.DefValue, Env: envName, Type: f.Value.Type()}
+				usage, err := renderHelpTemplate(f.Usage, data)
+				if err != nil {
+					panic(fmt.Sprintf("on help text of --%s (field %s), %+v", fieldname, rf.Name, err))
+				}
+				f.Usage = usage
+				if description, err := renderHelpTemplate(description, data); err == nil {
+					b.State.visitedFields[index].description = description
+				}
+			}
+		}
+
+		// for aliases (e.g. --deadline for --timeout), registered after the all wrappers of the value (e.g. fromfile, stdin)
+		if v, ok := rf.Tag.Lookup(b.AliasesTag); ok {
+			if f := fs.Lookup(fieldname); f != nil {
+				b.registerAliases(fs, f, rf, prefix, v)
+			}
+		}
+
+		b.onFlagRegistered(fs.Lookup(fieldname), rf)
+	}
+}
+
+// onFlagRegistered calls Config.OnFlagRegistered. (if f is nil, e.g. for nested struct, not called)
+func (b *Binder) onFlagRegistered(f *flag.Flag, rf reflect.StructField) {
+	if b.OnFlagRegistered == nil || f == nil {
+		return
+	}
+	b.OnFlagRegistered(f, rf)
+}
+
+// isStringerScalar returns true if the value is a non-string scalar implementing fmt.Stringer (but not pflag.Value, encoding.TextUnmarshaler)
+func isStringerScalar(fv reflect.Value) bool {
+	switch fv.Kind() {
+	case reflect.Bool, reflect.Int, reflect.Int64, reflect.Uint, reflect.Uint64, reflect.Float64:
+	default:
+		return false
+	}
+	if !fv.CanInterface() || fv.Type() == rTimeDurationType {
+		return false
+	}
+	if _, ok := fv.Interface().(fmt.Stringer); !ok {
+		return false
+	}
+	pt := reflect.PtrTo(fv.Type())
+	return !pt.Implements(rFlagValueType) && !pt.Implements(rTextUnmarshalerType)
+}
+
+// autoShorthand returns the first letter of the name, if it is not taken. (conflicts are skipped, returning empty string)
+func (b *Binder) autoShorthand(fs *flag.FlagSet, name string, reserved map[string]bool) string {
+	if name == "" {
+		return ""
+	}
+	c := name[0]
+	if !('a' <= c && c <= 'z' || 'A' <= c && c <= 'Z') || c == 'h' { // -h is for help
+		return ""
+	}
+	shorthand := string(c)
+	if reserved[shorthand] || fs.ShorthandLookup(shorthand) != nil {
+		return ""
+	}
+	return shorthand
+}
+
+// setDefaults calls SetDefaults() of the struct and its nested structs (children first).
+func (b *Binder) setDefaults(rv reflect.Value) {
+	rt := rv.Type()
+	for i := 0; i < rt.NumField(); i++ {
+		rf := rt.Field(i)
+		if _, _, skip := b.lookupFlagname(rf, ""); skip {
+			continue
+		}
+
+		fv := rv.Field(i)
+		if fv.Kind() == reflect.Ptr {
+			if fv.IsNil() {
+				continue
+			}
+			fv = fv.Elem()
+		}
+		if fv.Kind() != reflect.Struct || !fv.CanAddr() {
+			continue
+		}
+		if ft := reflect.PtrTo(fv.Type()); ft.Implements(rFlagValueType) || ft.Implements(rTextUnmarshalerType) {
+			continue
+		}
+		b.setDefaults(fv)
+	}
+
+	if impl, ok := reflect.NewAt(rt, unsafe.Pointer(rv.UnsafeAddr())).Interface().(Defaulter); ok {
+		impl.SetDefaults()
+	}
+}
+
+// envHelpText returns the envvar annotation of the help text. (if the envvar is not supported, returns empty string)
+func (b *Binder) envHelpText(fieldname string) string {
+	if !b.EnvvarSupport || b.EnvHelpFormat == "" {
+		return ""
+	}
+	envname := b.EnvNameFunc(fieldname)
+	if envname == "" {
+		return ""
+	}
+	return fmt.Sprintf(b.EnvHelpFormat, envname)
+}
+
+// nestedPrefix returns the prefix of the nested struct's flags. (e.g. "db.", or "database." with `flagprefix:"database"`)
+func (b *Binder) nestedPrefix(c fieldcontext) string {
+	if v, ok := c.field.Tag.Lookup(b.FlagPrefixTag); ok {
+		if v == "" { // flattened
+			return c.prefix
+		}
+		return c.prefix + v + "."
+	}
+	return c.fieldname + "." // c.fieldname is already prefixed
+}
+
+// isEmbeddedStruct returns true if the field is an embedded struct (or pointer of struct), flattened in walk.
+// (the embedded non-struct type, e.g. `type ID int`, is treated as a regular field named by the type name)
+func isEmbeddedStruct(rf reflect.StructField) bool {
+	if !rf.Anonymous {
+		return false
+	}
+	rt := rf.Type
+	if rt.Kind() == reflect.Ptr {
+		rt = rt.Elem()
+	}
+	return rt.Kind() == reflect.Struct
+}
+
+// lookupFlagname returns the flagname of the field. if skip is true, the field is not treated as a flag.
+func (b *Binder) lookupFlagname(rf reflect.StructField, prefix string) (fieldname string, hasFlagname bool, skip bool) {
+	fieldname = rf.Name
+	for _, tag := range b.FlagnameTags { // the first found tag provides the name (and "-" is checked only for it)
+		if v, ok := rf.Tag.Lookup(tag); ok {
+			fieldname = v
+			hasFlagname = true
+			break
+		}
+	}
+	if hasFlagname && b.ShorthandInFlagTag {
+		if name, _, ok := cutFlagTag(fieldname); ok {
+			fieldname = name // e.g. "verbose,v" -> "verbose"
+		}
+	}
+	if fieldname == "-" {
+		return "", false, true
+	}
+	if !hasFlagname && (!rf.IsExported() || !(b.IncludeAllExported || isEmbeddedStruct(rf))) {
+		return "", false, true
+	}
+	if hasFlagname && !rf.IsExported() && b.PanicOnUnexportedTagged {
+		panic(fmt.Sprintf("unexported field %s has flagname tag (%s)", rf.Name, fieldname))
+	}
+	if !hasFlagname && b.StripFieldPrefix != "" && len(fieldname) > len(b.StripFieldPrefix) {
+		fieldname = strings.TrimPrefix(fieldname, b.StripFieldPrefix)
+	}
+	if fieldname == "" { // e.g. `flag:""`, use the Go field name verbatim
+		return prefix + rf.Name, hasFlagname, false
+	}
+	if b.FlagNameFunc2 != nil {
+		return b.FlagNameFunc2(prefix, fieldname), hasFlagname, false
+	}
+	return b.FlagNameFunc(prefix + fieldname), hasFlagname, false
+}
+
+// lookupShorthand returns the shorthand of the field, from ShorthandTag (or the flagname tag, with Config.ShorthandInFlagTag).
+func (b *Binder) lookupShorthand(rf reflect.StructField) (string, bool) {
+	if v, ok := rf.Tag.Lookup(b.ShorthandTag); ok {
+		return v, true
+	}
+	if !b.ShorthandInFlagTag {
+		return "", false
+	}
+	for _, tag := range b.FlagnameTags {
+		if v, ok := rf.Tag.Lookup(tag); ok {
+			if _, shorthand, ok := cutFlagTag(v); ok {
+				return shorthand, true
+			}
+			return "", false
+		}
+	}
+	return "", false
+}
+
+// cutFlagTag splits the flagname tag into the name and the shorthand. (e.g. "verbose,v" -> "verbose", "v")
+// the second token is treated as the shorthand, only if it is a single character. (not to confuse with e.g. json's omitempty)
+func cutFlagTag(v string) (name string, shorthand string, ok bool) {
+	parts := strings.SplitN(v, ",", 3)
+	if len(parts) < 2 || len(parts[1]) != 1 {
+		return v, "", false
+	}
+	return parts[0], parts[1], true
+}
+
+type fieldcontext struct {
+	fieldname string
+	helpText  string
+	shorthand string
+	required  bool
+	sensitive bool
+	noEnv     bool
+	envName   string
+
+	allowedValues []string
+	description   string // help text without annotations
+	group         string // the description of the group (for nested struct)
+	persistent    bool
+	deprecated    string // the deprecation message, propagated to the fields of the nested struct
+
+	prefix      string
+	fieldPath   string // the path of the Go field (e.g. "DB.Host")
+	depth       int
+	hasFlagname bool
+	field       reflect.StructField
+	value       reflect.Value
+}
+
+func (c fieldcontext) info() FieldInfo {
+	return FieldInfo{
+		Name:      c.fieldname,
+		Shorthand: c.shorthand,
+		HelpText:  c.helpText,
+		Required:  c.required,
+		Sensitive: c.sensitive,
+		EnvName:   c.envName,
+		Prefix:    c.prefix,
+		FieldPath: c.fieldPath,
+		Field:     c.field,
+
+		AllowedValues: c.allowedValues,
+		Description:   c.description,
+		Group:         c.group,
+		Persistent:    c.persistent,
+	}
+}
+
+// FieldInfo is the information of the field bound to a flag.
+type FieldInfo struct {
+	Name      string // flag name
+	Shorthand string
+	HelpText  string
+	Required  bool
+	Sensitive bool
+	EnvName   string // empty if the envvar is not supported
+	Prefix    string // the path of the nested struct (e.g. "db.")
+	FieldPath string // the path of the Go field (e.g. "DB.URI")
+
+	Field reflect.StructField
+
+	AllowedValues []string // for enum (see HasAllowedValues)
+	Description   string   // the help text without annotations (e.g. envvar, [required])
+	Group         string   // the description of the group, for the nested struct field (see GroupTag)
+	Persistent    bool     // if true, the flag is inherited by the sub commands (see PersistentTag)
+}
+
+func (b *Binder) walkField(fs *flag.FlagSet, rt reflect.Type, fv reflect.Value, c fieldcontext) {
+	// for interface-typed field, binding with the concrete value
+	if rt.Kind() == reflect.Interface {
+		if fv.IsNil() {
+			return // skipped
+		}
+		impl := fv.Elem()
+		if v, ok := impl.Interface().(flag.Value); ok {
+			fs.VarP(v, c.fieldname, c.shorthand, c.helpText)
+			return
+		}
+		if impl.Kind() != reflect.Ptr {
+			panic(fmt.Sprintf("unsupported type %v (the concrete value of %v must be a pointer)", impl.Type(), rt))
+		}
+		b.walkField(fs, impl.Type(), impl, c)
+		return
+	}
+
+	// for *net.TCPAddr, *net.UDPAddr
+	if rt == rTCPAddrPtrType || rt == rUDPAddrPtrType {
+		ref := reflect.NewAt(rt, unsafe.Pointer(fv.UnsafeAddr())).Elem()
+		fs.VarP(&addrValue{v: ref}, c.fieldname, c.shorthand, c.helpText)
+		return
+	}
+
+	// for Optional[T]
+	if rt.Kind() == reflect.Struct {
+		if impl, ok := reflect.NewAt(rt, unsafe.Pointer(fv.UnsafeAddr())).Interface().(optionalField); ok {
+			b.bindOptional(fs, impl, c)
+			return
+		}
+	}
+
+	// for enum (TODO: skip check with cache)
+	{
+		fv := fv
+		ft := fv.Type()
+		isPtr := ft.Kind() == reflect.Ptr
+
+		// Set() is pointer receiver only
+		if !isPtr {
+			fv = fv.Addr()
+			ft = reflect.PtrTo(ft)
+		}
+
+		if ft.Implements(rFlagValueType) {
+			fs.VarP(fv.Interface().(flag.Value), c.fieldname, c.shorthand, c.helpText)
+			return
+		}
+
+		if ft.Implements(rTextUnmarshalerType) {
+			if fv.IsNil() && fv.CanAddr() {
+				// flagname is not found, will be skipped (even if the field is a pointer, with field tag, it will be treated as a flag forcely).
+				if !c.hasFlagname {
+					return
+				}
+				fv.Set(reflect.New(rt.Elem()))
+			}
+
+			ref := fv.Interface().(interface {
+				encoding.TextMarshaler
+				encoding.TextUnmarshaler
+			})
+			fs.VarP(newTextValue(ref, ref, isPtr), c.fieldname, c.shorthand, c.helpText)
+			return
+		}
+	}
+
+	if b.FlexibleNumbers && rt != rTimeDurationType {
+		switch rt.Kind() {
+		case reflect.Int, reflect.Int64, reflect.Uint, reflect.Uint64:
+			ref := reflect.NewAt(rt, unsafe.Pointer(fv.UnsafeAddr())).Elem()
+			fs.VarP(&flexibleNumberValue{v: ref}, c.fieldname, c.shorthand, c.helpText)
+			return
+		}
+	}
+
+	switch rt.Kind() {
+	case reflect.Ptr:
+		if fv.IsNil() && fv.CanAddr() {
+			// flagname is not found, will be skipped (even if the field is a pointer, with field tag, it will be treated as a flag forcely).
 			if !c.hasFlagname {
-				if c.field.Anonymous {
+				if isEmbeddedStruct(c.field) {
 					// for shared common option (child)
 					typ := c.field.Type
 					b.State.embeddedStructPointerMap[typ] = append(b.State.embeddedStructPointerMap[typ], fv)
 				}
 				return
 			}
+			if b.LazyPointerAlloc && canAllocLazily(rt.Elem()) {
+				f := fs.VarPF(newLazyPtrValue(reflect.NewAt(rt, unsafe.Pointer(fv.UnsafeAddr())).Elem()), c.fieldname, c.shorthand, c.helpText)
+				if rt.Elem().Kind() == reflect.Bool {
+					f.NoOptDefVal = "true"
+				}
+				return
+			}
 			fv.Set(reflect.New(rt.Elem()))
+			if rt.Elem().Kind() == reflect.Struct {
+				b.setDefaults(fv.Elem())
+			}
 		}
 		b.walkField(fs, rt.Elem(), fv.Elem(), c)
 	case reflect.Struct:
@@ -325,14 +1371,31 @@ func (b *Binder) walkField(fs *flag.FlagSet, rt reflect.Type, fv reflect.Value,
 			b.State.toplevelStructMap[fv.Type()] = fv
 		}
 
-		if c.field.Anonymous {
-			b.walk(fs, rt, fv, c.prefix)
+		if c.field.Tag.Get(b.InlineTag) == "kv" {
+			ref := reflect.NewAt(rt, unsafe.Pointer(fv.UnsafeAddr())).Elem()
+			fs.VarP(b.newKVStructValue(rt, ref), c.fieldname, c.shorthand, c.helpText)
 			return
 		}
-		b.walk(fs, rt, fv, c.prefix+c.fieldname+".")
+
+		if c.field.Anonymous && !b.PrefixAnonymous {
+			b.walk(fs, rt, fv, c.prefix, c.fieldPath+".", c.depth, c.deprecated)
+			return
+		}
+		b.walk(fs, rt, fv, b.nestedPrefix(c), c.fieldPath+".", c.depth+1, c.deprecated)
 	case reflect.Bool:
 		ref := (*bool)(unsafe.Pointer(fv.UnsafeAddr()))
 		fs.BoolVarP(ref, c.fieldname, c.shorthand, fv.Bool(), c.helpText)
+		if ok, _ := strconv.ParseBool(c.field.Tag.Get(b.NegatableTag)); ok || b.NegatableBools {
+			// for negative flag (e.g. --no-verbose), the last one wins
+			name := c.prefix + "no-" + strings.TrimPrefix(c.fieldname, c.prefix)
+			f := fs.VarPF(&negativeBoolValue{p: ref}, name, "", "negative flag of --"+c.fieldname)
+			f.NoOptDefVal = "true"
+			f.Hidden = true
+			b.onFlagRegistered(f, c.field)
+		}
+	case reflect.Complex64, reflect.Complex128:
+		ref := reflect.NewAt(rt, unsafe.Pointer(fv.UnsafeAddr())).Elem()
+		fs.VarP(&complexValue{v: ref}, c.fieldname, c.shorthand, c.helpText)
 	case reflect.Float64:
 		ref := (*float64)(unsafe.Pointer(fv.UnsafeAddr()))
 		fs.Float64VarP(ref, c.fieldname, c.shorthand, fv.Float(), c.helpText)
@@ -359,6 +1422,28 @@ func (b *Binder) walkField(fs *flag.FlagSet, rt reflect.Type, fv reflect.Value,
 		fs.UintVarP(ref, c.fieldname, c.shorthand, uint(fv.Uint()), c.helpText)
 	case reflect.Slice:
 		switch rt.Elem().Kind() {
+		case reflect.Ptr:
+			ref := reflect.NewAt(rt, unsafe.Pointer(fv.UnsafeAddr())).Elem()
+			fs.VarP(newPtrSliceValue(ref), c.fieldname, c.shorthand, c.helpText)
+		case reflect.Struct:
+			switch rt.Elem() {
+			case rTimeType:
+				layout := time.RFC3339
+				if v, ok := c.field.Tag.Lookup(b.LayoutTag); ok {
+					layout = v
+				}
+				ref := (*[]time.Time)(unsafe.Pointer(fv.UnsafeAddr()))
+				fs.VarP(&timeSliceValue{p: ref, layout: layout}, c.fieldname, c.shorthand, c.helpText)
+			default:
+				sf := structSliceField{fieldname: c.fieldname, value: fv, max: -1}
+				if v, ok := c.field.Tag.Lookup(b.MaxLenTag); ok {
+					sf.max = parseMaxLen(c.field, v)
+				}
+				b.State.structSliceFields = append(b.State.structSliceFields, sf)
+				for i := 0; i < fv.Len(); i++ {
+					b.registerStructSliceElem(fs, sf, i) // for default value
+				}
+			}
 		case reflect.Bool:
 			var defaultValue []bool
 			for i := 0; i < fv.Len(); i++ {
@@ -403,6 +1488,10 @@ func (b *Binder) walkField(fs *flag.FlagSet, rt reflect.Type, fv reflect.Value,
 				defaultValue = append(defaultValue, fv.Index(i).String())
 			}
 			ref := (*[]string)(unsafe.Pointer(fv.UnsafeAddr()))
+			if ok, _ := strconv.ParseBool(c.field.Tag.Get(b.ArrayTag)); ok {
+				fs.StringArrayVarP(ref, c.fieldname, c.shorthand, defaultValue, c.helpText) // not split by comma
+				return
+			}
 			fs.StringSliceVarP(ref, c.fieldname, c.shorthand, defaultValue, c.helpText)
 		case reflect.Uint:
 			var defaultValue []uint
@@ -415,21 +1504,219 @@ func (b *Binder) walkField(fs *flag.FlagSet, rt reflect.Type, fv reflect.Value,
 		default:
 			panic(fmt.Sprintf("unsupported slice type %v", rt))
 		}
+	case reflect.Map:
+		if rt.Key().Kind() != reflect.String || rt.Elem().Kind() != reflect.Struct {
+			panic(fmt.Sprintf("unsupported map type %v (only map of struct with string key)", rt))
+		}
+		sf := structMapField{fieldname: c.fieldname, value: fv}
+		b.State.structMapFields = append(b.State.structMapFields, sf)
+		iter := fv.MapRange()
+		for iter.Next() {
+			b.registerStructMapElem(fs, sf, iter.Key().String()) // for default value
+		}
 	default:
-		// TODO: map
 		panic(fmt.Sprintf("unsupported type %v", rt))
 	}
 }
 
+// ErrVersion is the error returned if the --version flag is set under ContinueOnError.
+var ErrVersion = errors.New("flagstruct: version requested")
+
+// TerminateFunc is called when the terminating flag is set (e.g. printing something), see FlagSet.Terminate.
+type TerminateFunc func(fs *FlagSet) error
+
+// ErrTerminated is the error returned if the terminating flag is set under ContinueOnError.
+type ErrTerminated struct {
+	Flag string // the name of the flag triggered it
+}
+
+func (e *ErrTerminated) Error() string {
+	return fmt.Sprintf("flagstruct: terminated by --%s", e.Flag)
+}
+
+// MultiError is the error aggregating multiple errors. (e.g. several required flags are missing)
+// The message is the messages of the errors, joined by newline.
+type MultiError struct {
+	errs []error
+}
+
+// newMultiError returns *MultiError, or nil if errs is empty.
+func newMultiError(errs []error) error {
+	if len(errs) == 0 {
+		return nil
+	}
+	return &MultiError{errs: errs}
+}
+
+func (e *MultiError) Error() string {
+	msgs := make([]string, len(e.errs))
+	for i, err := range e.errs {
+		msgs[i] = err.Error()
+	}
+	return strings.Join(msgs, "\n")
+}
+
+// Errors returns the aggregated errors.
+func (e *MultiError) Errors() []error {
+	return e.errs
+}
+
+// Unwrap returns the aggregated errors. (for errors.Is and errors.As, with Go 1.20 or later)
+func (e *MultiError) Unwrap() []error {
+	return e.errs
+}
+
+// for hiding zero default value in help, used only for rendering the usage
+// (pflag omits the default value annotation of the unknown types, if String() returns empty string)
+type zeroDefaultValue struct {
+	flag.Value
+}
+
+func (v *zeroDefaultValue) String() string {
+	return ""
+}
+
+// showsDefault returns true if the default value annotation is shown in the usage of pflag.
+func showsDefault(f *flag.Flag) bool {
+	g := *f
+	g.Usage = ""
+	g.Hidden = false
+	tmp := flag.NewFlagSet("", flag.ContinueOnError)
+	tmp.AddFlag(&g)
+	return strings.Contains(tmp.FlagUsages(), "(default ")
+}
+
+// for negative flag (e.g. --no-verbose)
+type negativeBoolValue struct {
+	p *bool
+}
+
+func (v *negativeBoolValue) Set(s string) error {
+	b, err := strconv.ParseBool(s)
+	if err != nil {
+		return err
+	}
+	*v.p = !b
+	return nil
+}
+
+func (v *negativeBoolValue) String() string {
+	return "false"
+}
+
+// for pflag.Value
+func (v *negativeBoolValue) Type() string {
+	return "bool"
+}
+
 type FlagSet struct {
 	*flag.FlagSet
 	Binder *Binder
 }
 
 func (fs *FlagSet) Parse(args []string) error {
+	fs.Binder.State.stdinConsumer = "" // stdin can be read once per Parse
+
+	// for response file
+	if fs.Binder.ExpandResponseFiles {
+		expanded, err := expandResponseFiles(args)
+		if err != nil {
+			return err
+		}
+		args = expanded
+	}
+
+	// for struct slice, struct map
+	fs.Binder.registerStructSliceFlags(fs.FlagSet, args)
+	fs.Binder.registerStructMapFlags(fs.FlagSet, args)
+
+	// for Windows-style flag
+	if fs.Binder.AllowSlashFlags {
+		args = rewriteSlashFlags(fs.FlagSet, args)
+	}
+
+	// for abbreviated flag
+	if fs.Binder.AllowAbbrev {
+		expanded, err := expandAbbrevFlags(fs.FlagSet, args, fs.Binder.State.aliases)
+		if err != nil {
+			return err
+		}
+		args = expanded
+	}
+
+	// for shorthand-only flag
+	if len(fs.Binder.State.shortOnly) > 0 {
+		if err := rejectShortOnlyFlags(fs.FlagSet, fs.Binder.State.shortOnly, args); err != nil {
+			return err
+		}
+	}
+
+	// for unknown flags
+	if fs.Binder.AllowUnknownFlags {
+		fs.Binder.State.unknownFlags = collectUnknownFlags(fs.FlagSet, args)
+	}
+
 	if err := fs.FlagSet.Parse(args); err != nil {
 		return err
 	}
+	if len(fs.Binder.State.aliases) > 0 {
+		fs.Binder.syncAliases(fs.FlagSet)
+	}
+	fs.Binder.State.sources = map[string]Source{}
+	fs.VisitAll(func(f *flag.Flag) {
+		if f.Changed {
+			fs.Binder.State.sources[f.Name] = SourceCommandLine
+		} else {
+			fs.Binder.State.sources[f.Name] = SourceDefault
+		}
+	})
+
+	// for --version
+	if fs.Binder.State.versionRequested {
+		w := flagOutput(fs.FlagSet) // the version is written to stdout, if the output is not set
+		if w == nil {
+			w = os.Stdout
+		}
+		fmt.Fprintln(w, fs.Binder.Version)
+		switch fs.Binder.HandlingMode {
+		case flag.ContinueOnError:
+			return ErrVersion
+		case flag.ExitOnError:
+			os.Exit(0)
+		case flag.PanicOnError:
+			panic(ErrVersion)
+		}
+	}
+
+	// for terminating flags
+	if len(fs.Binder.State.terminators) > 0 {
+		if err := fs.terminateIfRequested(); err != nil {
+			return err
+		}
+	}
+
+	// for the number of the remaining arguments (the arguments after `--` are not counted, if they are passed through)
+	n := len(fs.Args())
+	if len(fs.Binder.State.passthroughFields) > 0 && fs.ArgsLenAtDash() >= 0 {
+		n = fs.ArgsLenAtDash()
+	}
+	if n < fs.Binder.MinNArgs {
+		return fmt.Errorf("requires at least %d arg(s), only received %d", fs.Binder.MinNArgs, n)
+	} else if maxN := fs.Binder.MaxNArgs; maxN != nil && n > *maxN {
+		return fmt.Errorf("accepts at most %d arg(s), received %d", *maxN, n)
+	}
+
+	// for passthrough
+	if len(fs.Binder.State.passthroughFields) > 0 {
+		var passthrough []string
+		if n := fs.ArgsLenAtDash(); n >= 0 {
+			passthrough = append([]string{}, fs.Args()[n:]...)
+		}
+		for _, fv := range fs.Binder.State.passthroughFields {
+			ref := (*[]string)(unsafe.Pointer(fv.UnsafeAddr()))
+			*ref = passthrough
+		}
+	}
 
 	// for envar
 	if fs.Binder.EnvvarSupport {
@@ -437,6 +1724,56 @@ func (fs *FlagSet) Parse(args []string) error {
 			return err
 		}
 	}
+	return fs.resolve()
+}
+
+// ParseEnvOnly is like Parse, but reads only envvars (no command-line arguments). (even if Config.EnvvarSupport is false)
+// The required flags and Validate() of the fields are also checked.
+func (fs *FlagSet) ParseEnvOnly() error {
+	fs.Binder.State.sources = map[string]Source{}
+	fs.VisitAll(func(f *flag.Flag) {
+		fs.Binder.State.sources[f.Name] = SourceDefault
+	})
+	if err := fs.Binder.setByEnvvars(fs.FlagSet); err != nil {
+		return err
+	}
+	if err := fs.resolve(); err != nil {
+		return err
+	}
+	return fs.Validate()
+}
+
+// Complete runs the rest of Parse, for the FlagSet parsed by the others (e.g. cobra's cmd.Flags(), with BuildInto).
+// The envvars are read (if Config.EnvvarSupport), and the required flags are checked.
+func (fs *FlagSet) Complete() error {
+	if len(fs.Binder.State.aliases) > 0 {
+		fs.Binder.syncAliases(fs.FlagSet)
+	}
+	fs.Binder.State.sources = map[string]Source{}
+	fs.VisitAll(func(f *flag.Flag) {
+		if f.Changed {
+			fs.Binder.State.sources[f.Name] = SourceCommandLine
+		} else {
+			fs.Binder.State.sources[f.Name] = SourceDefault
+		}
+	})
+
+	if fs.Binder.EnvvarSupport {
+		if err := fs.Binder.setByEnvvars(fs.FlagSet); err != nil {
+			return err
+		}
+	}
+	return fs.resolve()
+}
+
+// resolve runs the rest of parsing, after the command-line arguments and envvars are read.
+func (fs *FlagSet) resolve() error {
+	// for secret reference
+	if len(fs.Binder.State.secretRefs) > 0 {
+		if err := fs.Binder.resolveSecretRefs(fs.FlagSet); err != nil {
+			return err
+		}
+	}
 
 	// for shared common option
 	if len(fs.Binder.State.embeddedStructPointerMap) > 0 {
@@ -445,9 +1782,393 @@ func (fs *FlagSet) Parse(args []string) error {
 		}
 	}
 
+	// for glob expansion
+	if len(fs.Binder.State.globFields) > 0 {
+		if err := fs.Binder.expandGlobFields(); err != nil {
+			return err
+		}
+	}
+
+	// for interactive prompt
+	if fs.Binder.InteractivePrompt {
+		if err := fs.Binder.promptRequiredFlags(fs.FlagSet); err != nil {
+			return err
+		}
+	}
+
+	// for dynamic flags
+	fs.Binder.syncDynamicValues()
+
+	// for minimum length of slice fields
+	if len(fs.Binder.State.minLenFields) > 0 {
+		if err := fs.Binder.checkMinLenFields(); err != nil {
+			return err
+		}
+	}
+
 	return fs.Binder.ValidateRequiredFlags(fs.FlagSet)
 }
 
+// Check parses the args with a cloned struct, and returns the error if any. (like ContinueOnError, never exits)
+// The bound struct is not modified. (for validating the args, e.g. in a test harness)
+func (fs *FlagSet) Check(args []string) error {
+	_, err := fs.dryRun(args)
+	return err
+}
+
+// dryRun parses the args with the FlagSet built for the cloned structs. (the bound structs are not modified)
+func (fs *FlagSet) dryRun(args []string) (shadow *FlagSet, retErr error) {
+	clones := make([]interface{}, len(fs.Binder.State.targets))
+	for i, target := range fs.Binder.State.targets {
+		clone := reflect.New(target.Type().Elem())
+		copyValue(clone.Elem(), target.Elem())
+		clones[i] = clone.Interface()
+	}
+
+	c := *fs.Binder.Config
+	c.HandlingMode = flag.ContinueOnError
+	c.InteractivePrompt = false
+	c.OnFlagRegistered = nil
+	c.Version = ""                  // not to print the version
+	c.Stdin = strings.NewReader("") // not to consume stdin
+	b := &Builder{Name: fs.Binder.State.name, Config: &c}
+
+	defer func() {
+		if r := recover(); r != nil {
+			retErr = fmt.Errorf("on check, %v", r)
+		}
+	}()
+	shadow = b.BuildMany(clones...)
+	if fs.Binder.Version != "" {
+		shadow.Bool("version", false, "show version")
+	}
+	shadow.SetOutput(io.Discard)
+	return shadow, shadow.Parse(args)
+}
+
+// SetHandlingMode changes the error handling mode of Parse, after building. (the Config shared with the Builder is not modified)
+func (fs *FlagSet) SetHandlingMode(mode flag.ErrorHandling) {
+	c := *fs.Binder.Config
+	c.HandlingMode = mode
+	fs.Binder.Config = &c
+	setErrorHandling(fs.FlagSet, mode)
+}
+
+// setErrorHandling changes only the error handling mode of fs.
+// (pflag.FlagSet has no setter, and Init also resets the name, e.g. of cobra's FlagSet passed to BuildInto)
+func setErrorHandling(fs *flag.FlagSet, mode flag.ErrorHandling) {
+	rv := reflect.ValueOf(fs).Elem().FieldByName("errorHandling")
+	if !rv.IsValid() || rv.Type() != reflect.TypeOf(mode) {
+		panic(fmt.Sprintf("unsupported version of pflag, %T has no errorHandling field", fs))
+	}
+	*(*flag.ErrorHandling)(unsafe.Pointer(rv.UnsafeAddr())) = mode
+}
+
+// Terminate registers the flag as terminating, like --version. If the flag is set, Parse calls fn and stops.
+// (under ContinueOnError, Parse returns *ErrTerminated. the flags are checked in declaration order, and only the first one is called)
+func (fs *FlagSet) Terminate(name string, fn TerminateFunc) {
+	f := fs.Lookup(name)
+	if f == nil {
+		panic(fmt.Sprintf("flag --%s is not defined", name))
+	}
+	if fs.Binder.State.terminators == nil {
+		fs.Binder.State.terminators = map[string]TerminateFunc{}
+	}
+	fs.Binder.State.terminators[f.Name] = fn
+}
+
+func (fs *FlagSet) terminateIfRequested() error {
+	var found *flag.Flag
+	sortFlags := fs.SortFlags
+	fs.SortFlags = false // for declaration order
+	fs.VisitAll(func(f *flag.Flag) {
+		if found == nil && f.Changed && fs.Binder.State.terminators[f.Name] != nil {
+			found = f
+		}
+	})
+	fs.SortFlags = sortFlags
+	if found == nil {
+		return nil
+	}
+
+	if err := fs.Binder.State.terminators[found.Name](fs); err != nil {
+		return fmt.Errorf("on --%s, %w", found.Name, err)
+	}
+	err := &ErrTerminated{Flag: found.Name}
+	switch fs.Binder.HandlingMode {
+	case flag.ExitOnError:
+		os.Exit(0)
+	case flag.PanicOnError:
+		panic(err)
+	}
+	return err
+}
+
+// Validate calls Validate() of the bound fields implementing Validator (e.g. enum), aggregating the errors.
+// (useful after mutating the struct directly)
+func (fs *FlagSet) Validate() error {
+	var errs []error
+	for _, fc := range fs.Binder.State.visitedFields {
+		fv := fc.value
+		if !fv.CanInterface() { // for unexported field
+			fv = reflect.NewAt(fv.Type(), unsafe.Pointer(fv.UnsafeAddr())).Elem()
+		}
+		if fv.Kind() == reflect.Ptr && fv.IsNil() {
+			continue
+		}
+
+		impl, ok := fv.Interface().(Validator)
+		if !ok && fv.CanAddr() {
+			impl, ok = fv.Addr().Interface().(Validator)
+		}
+		if !ok {
+			continue
+		}
+		if err := impl.Validate(); err != nil {
+			errs = append(errs, fmt.Errorf("on --%s, %w", fc.fieldname, err))
+		}
+	}
+	return newMultiError(errs)
+}
+
+// SetAll sets the values of flags (flagname -> value), like the envvar pass. The errors are aggregated.
+// (for slice flags, the value is split by comma)
+func (fs *FlagSet) SetAll(values map[string]string) error {
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var errs []error
+	for _, name := range names {
+		if err := fs.Set(name, values[name]); err != nil {
+			errs = append(errs, fmt.Errorf("on %s=%v, %w", name, values[name], err))
+		}
+	}
+	return newMultiError(errs)
+}
+
+// Unmarshal copies the values of flags to dst (pointer of struct), matching the fields by the same tag/name rules.
+// (the fields of dst without the corresponding flag are not modified)
+func (fs *FlagSet) Unmarshal(dst interface{}) error {
+	dfs, err := fs.buildShadow(dst)
+	if err != nil {
+		return fmt.Errorf("on unmarshal %T, %w", dst, err)
+	}
+
+	var msgs []string
+	dfs.VisitAll(func(df *flag.Flag) {
+		f := fs.Lookup(df.Name)
+		if f == nil {
+			return
+		}
+		if _, ok := fs.Binder.State.aliases[f.Name]; ok { // already copied via the canonical flag
+			return
+		}
+		if err := copyFlagValue(df, f); err != nil {
+			msgs = append(msgs, err.Error())
+		}
+	})
+	if len(msgs) > 0 {
+		return errors.New(strings.Join(msgs, "\n"))
+	}
+	return nil
+}
+
+// buildShadow builds the FlagSet for another struct with the same config. (without --version and hooks)
+func (fs *FlagSet) buildShadow(o interface{}) (*FlagSet, error) {
+	c := *fs.Binder.Config
+	c.Version = ""
+	c.OnFlagRegistered = nil
+	b := &Builder{Name: "-", Config: &c}
+	return b.BuildE(o)
+}
+
+// copyFlagValue copies the value of src flag to dst flag. (dst is not marked as changed)
+func copyFlagValue(dst, src *flag.Flag) error {
+	if _, ok := src.Value.(*negativeBoolValue); ok { // already reflected to the positive flag
+		return nil
+	}
+
+	if sv, ok := src.Value.(flag.SliceValue); ok {
+		if dsv, ok := dst.Value.(flag.SliceValue); ok {
+			if err := dsv.Replace(sv.GetSlice()); err != nil {
+				return fmt.Errorf("on %s, %+v", src.Name, err)
+			}
+			return nil
+		}
+	}
+
+	v := src.Value.String()
+	if strings.HasSuffix(src.Value.Type(), "Slice") && strings.HasPrefix(v, "[") && strings.HasSuffix(v, "]") {
+		v = v[1 : len(v)-1] // e.g. []*int, []time.Time
+		if v == "" {
+			return nil
+		}
+	}
+	if err := dst.Value.Set(v); err != nil {
+		return fmt.Errorf("on %s=%v, %+v", src.Name, v, err)
+	}
+	return nil
+}
+
+// LookupByFieldPath returns the flag bound to the Go field path (e.g. "DB.Host").
+// (if the field is not bound to any flag, returns nil)
+func (fs *FlagSet) LookupByFieldPath(path string) *flag.Flag {
+	for _, fc := range fs.Binder.State.visitedFields {
+		if fc.fieldPath == path {
+			return fs.Lookup(fc.fieldname)
+		}
+	}
+	return nil
+}
+
+// EnvVars returns the names of envvars read in Parse, in flag-declaration order.
+func (fs *FlagSet) EnvVars() []string {
+	var r []string
+	for _, fc := range fs.Binder.State.visitedFields {
+		if fc.envName == "" || fs.Lookup(fc.fieldname) == nil { // skip the nested struct itself
+			continue
+		}
+		r = append(r, fc.envName)
+	}
+	return r
+}
+
+// Output returns the destination for usage and error messages of the underlying pflag.FlagSet (os.Stderr if not set).
+func (fs *FlagSet) Output() io.Writer {
+	if w := flagOutput(fs.FlagSet); w != nil {
+		return w
+	}
+	return os.Stderr
+}
+
+// flagOutput returns the output of fs set by SetOutput, or nil if not set. (pflag.FlagSet doesn't expose it)
+func flagOutput(fs *flag.FlagSet) io.Writer {
+	rv := reflect.ValueOf(fs).Elem().FieldByName("output")
+	if !rv.IsValid() || rv.Type() != reflect.TypeOf((*io.Writer)(nil)).Elem() {
+		panic(fmt.Sprintf("unsupported version of pflag, %T has no output field", fs))
+	}
+	return *(*io.Writer)(unsafe.Pointer(rv.UnsafeAddr()))
+}
+
+// UnknownFlags returns the unknown flags (and their values) ignored in Parse. (only when Config.AllowUnknownFlags is true)
+func (fs *FlagSet) UnknownFlags() []string {
+	return fs.Binder.State.unknownFlags
+}
+
+// MarshalConfig returns the JSON of the bound struct (after parsing, the effective configuration), for logging.
+// The sensitive fields are masked (string fields are SensitiveMask, the others are zero value).
+// (if multiple structs are bound by BuildMany, returns JSON array)
+func (fs *FlagSet) MarshalConfig() ([]byte, error) {
+	values := make([]interface{}, len(fs.Binder.State.targets))
+	for i, target := range fs.Binder.State.targets {
+		tmp := reflect.New(target.Type().Elem())
+		copyValue(tmp.Elem(), target.Elem())
+		for _, fc := range fs.Binder.State.visitedFields {
+			if !fc.sensitive {
+				continue
+			}
+			if fv, ok := fieldByPath(tmp.Elem(), fc.fieldPath); ok {
+				maskValue(fv)
+			}
+		}
+		values[i] = tmp.Interface()
+	}
+	if len(values) == 1 {
+		return json.Marshal(values[0])
+	}
+	return json.Marshal(values)
+}
+
+// fieldByPath returns the field by the Go field path (e.g. "DB.Password"), dereferencing the pointers.
+func fieldByPath(rv reflect.Value, path string) (reflect.Value, bool) {
+	for _, name := range strings.Split(path, ".") {
+		for rv.Kind() == reflect.Ptr {
+			if rv.IsNil() {
+				return reflect.Value{}, false
+			}
+			rv = rv.Elem()
+		}
+		if rv.Kind() != reflect.Struct {
+			return reflect.Value{}, false
+		}
+		rv = rv.FieldByName(name)
+		if !rv.IsValid() || !rv.CanSet() {
+			return reflect.Value{}, false
+		}
+	}
+	return rv, true
+}
+
+func maskValue(fv reflect.Value) {
+	if fv.Kind() == reflect.Ptr && !fv.IsNil() && fv.Elem().Kind() == reflect.String {
+		fv = fv.Elem()
+	}
+	if fv.Kind() == reflect.String {
+		if fv.Len() > 0 {
+			fv.SetString(SensitiveMask)
+		}
+		return
+	}
+	fv.Set(reflect.Zero(fv.Type()))
+}
+
+// SensitiveMask is the string displayed instead of the value of the sensitive flag.
+const SensitiveMask = "****"
+
+// DisplayValue returns the string representation of the flag value for output.
+// (if the flag is marked as sensitive, returns SensitiveMask)
+func (fs *FlagSet) DisplayValue(name string) (string, error) {
+	f := fs.Lookup(name)
+	if f == nil {
+		return "", fmt.Errorf("flag accessed but not defined: %s", name)
+	}
+	normalize := fs.GetNormalizeFunc()
+	for _, sensitiveName := range fs.Binder.AllSensitiveFlagNames() {
+		if string(normalize(fs.FlagSet, sensitiveName)) == f.Name {
+			return SensitiveMask, nil
+		}
+	}
+	return f.Value.String(), nil
+}
+
+// Get returns the value of the field bound to the flag.
+func (fs *FlagSet) Get(name string) (interface{}, error) {
+	f := fs.Lookup(name)
+	if f == nil {
+		return nil, fmt.Errorf("flag accessed but not defined: %s", name)
+	}
+
+	normalize := fs.GetNormalizeFunc()
+	for _, fc := range fs.Binder.State.visitedFields {
+		if string(normalize(fs.FlagSet, fc.fieldname)) != f.Name {
+			continue
+		}
+		fv := fc.value
+		if !fv.CanInterface() { // for unexported field
+			fv = reflect.NewAt(fv.Type(), unsafe.Pointer(fv.UnsafeAddr())).Elem()
+		}
+		return fv.Interface(), nil
+	}
+	return nil, fmt.Errorf("flag %s is not bound to any field", name)
+}
+
+// Get returns the value of the field bound to the flag, as T.
+func Get[T any](fs *FlagSet, name string) (T, error) {
+	var zero T
+	v, err := fs.Get(name)
+	if err != nil {
+		return zero, err
+	}
+	r, ok := v.(T)
+	if !ok {
+		return zero, fmt.Errorf("trying to get %T value of flag of type %T (flag=%s)", zero, v, name)
+	}
+	return r, nil
+}
+
 func Build[T any](o *T, options ...func(*Builder)) *FlagSet {
 	b := NewBuilder()
 	b.HandlingMode = flag.ContinueOnError
@@ -2,11 +2,17 @@ package flagstruct_test
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"net"
+	"os"
+	"path/filepath"
 	"reflect"
+	"strconv"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/podhmo/flagstruct"
 	"github.com/spf13/pflag"
@@ -109,6 +115,107 @@ func TestBuilder_Build(t *testing.T) {
 				return newBuilder(), &Options{}
 			},
 		},
+		{
+			name: "types--int-pointer-slice",
+			args: []string{"-n", "20", "-n", "30"},
+			want: `{"Nums": [20, 30]}`,
+			create: func() (*flagstruct.Builder, interface{}) {
+				type Options struct {
+					Nums []*int `flag:"nums" short:"n"`
+				}
+				return newBuilder(), &Options{}
+			},
+		},
+		{
+			name: "types--int-pointer-slice,default",
+			args: []string{"--nums2", "20,30"},
+			want: `{"Nums": [10], "Nums2": [20, 30]}`,
+			create: func() (*flagstruct.Builder, interface{}) {
+				type Options struct {
+					Nums  []*int `flag:"nums"`
+					Nums2 []*int `flag:"nums2"`
+				}
+				n := 10
+				return newBuilder(), &Options{Nums: []*int{&n}, Nums2: []*int{&n}}
+			},
+		},
+		{
+			name: "types--string-pointer-slice",
+			args: []string{"--names", "foo", "--names", "bar"},
+			want: `{"Names": ["foo", "bar"]}`,
+			create: func() (*flagstruct.Builder, interface{}) {
+				type Options struct {
+					Names []*string `flag:"names"`
+				}
+				return newBuilder(), &Options{}
+			},
+		},
+		{
+			name: "types--string-slice",
+			args: []string{"--names", "a,b", "--names", "c"},
+			want: `{"Names": ["a", "b", "c"]}`,
+			create: func() (*flagstruct.Builder, interface{}) {
+				type Options struct {
+					Names []string `flag:"names"`
+				}
+				return newBuilder(), &Options{}
+			},
+		},
+		{
+			name: "types--string-slice,array",
+			args: []string{"--names", "a,b", "--names", "c"},
+			want: `{"Names": ["a,b", "c"]}`,
+			create: func() (*flagstruct.Builder, interface{}) {
+				type Options struct {
+					Names []string `flag:"names" array:"true"`
+				}
+				return newBuilder(), &Options{Names: []string{"x,y"}}
+			},
+		},
+		{
+			name: "types--string-slice,array,default",
+			args: []string{},
+			want: `{"Names": ["x,y"]}`,
+			create: func() (*flagstruct.Builder, interface{}) {
+				type Options struct {
+					Names []string `flag:"names" array:"true"`
+				}
+				return newBuilder(), &Options{Names: []string{"x,y"}}
+			},
+		},
+		{
+			name: "options--noarg",
+			args: []string{"--color"},
+			want: `{"Color": "auto"}`,
+			create: func() (*flagstruct.Builder, interface{}) {
+				type Options struct {
+					Color string `flag:"color" noarg:"auto"`
+				}
+				return newBuilder(), &Options{Color: "never"}
+			},
+		},
+		{
+			name: "options--noarg,with-value",
+			args: []string{"--color=never"},
+			want: `{"Color": "never"}`,
+			create: func() (*flagstruct.Builder, interface{}) {
+				type Options struct {
+					Color string `flag:"color" noarg:"auto"`
+				}
+				return newBuilder(), &Options{Color: "always"}
+			},
+		},
+		{
+			name: "options--noarg,default",
+			args: []string{},
+			want: `{"Color": "never"}`,
+			create: func() (*flagstruct.Builder, interface{}) {
+				type Options struct {
+					Color string `flag:"color" noarg:"auto"`
+				}
+				return newBuilder(), &Options{Color: "never"}
+			},
+		},
 		{
 			name: "options--long",
 			args: []string{"--verbose"},
@@ -153,6 +260,95 @@ func TestBuilder_Build(t *testing.T) {
 				return newBuilder(), &Options{}
 			},
 		},
+		{
+			name: "options--empty-tag",
+			args: []string{"--MaxRetries", "3"},
+			want: `{"MaxRetries":3}`,
+			create: func() (*flagstruct.Builder, interface{}) {
+				type Options struct {
+					MaxRetries int `flag:""`
+				}
+				b := newBuilder()
+				b.FlagNameFunc = strings.ToLower // bypassed
+				return b, &Options{}
+			},
+		},
+		{
+			name: "options--negatable",
+			args: []string{"--no-verbose"},
+			want: `{"Verbose":false}`,
+			create: func() (*flagstruct.Builder, interface{}) {
+				type Options struct {
+					Verbose bool `flag:"verbose" negatable:"true"`
+				}
+				return newBuilder(), &Options{Verbose: true}
+			},
+		},
+		{
+			name: "options--negatable,nested,must-be-prefixed",
+			args: []string{"--no-verbose", "--verbose", "--no-debug"},
+			want: `{"DB":{"Debug":false},"Verbose":true}`,
+			create: func() (*flagstruct.Builder, interface{}) {
+				type Options struct {
+					DB struct {
+						Debug bool `flag:"debug"`
+					} `flag:"db"`
+					Verbose bool `flag:"verbose"`
+				}
+				b := newBuilder()
+				b.NegatableBools = true
+				options := &Options{}
+				options.DB.Debug = true
+				return b, options
+			},
+			errorString: "unknown flag: --no-debug",
+		},
+		{
+			name: "options--negatable,nested,last-wins",
+			args: []string{"--no-verbose", "--verbose", "--db.no-debug"},
+			want: `{"DB":{"Debug":false},"Verbose":true}`,
+			create: func() (*flagstruct.Builder, interface{}) {
+				type Options struct {
+					DB struct {
+						Debug bool `flag:"debug"`
+					} `flag:"db"`
+					Verbose bool `flag:"verbose"`
+				}
+				b := newBuilder()
+				b.NegatableBools = true
+				options := &Options{}
+				options.DB.Debug = true
+				return b, options
+			},
+		},
+		{
+			name: "options--FlagNameFunc2",
+			args: []string{"--DB.max-conns", "10"},
+			want: `{"DB":{"MaxConns":10}}`,
+			create: func() (*flagstruct.Builder, interface{}) {
+				type Options struct {
+					DB struct {
+						MaxConns int
+					}
+				}
+				b := newBuilder()
+				b.FlagNameFunc2 = func(prefix, name string) string {
+					// kebab-case the leaf only
+					var buf strings.Builder
+					for i, r := range name {
+						if i > 0 && 'A' <= r && r <= 'Z' {
+							buf.WriteByte('-')
+						}
+						buf.WriteRune(r)
+					}
+					if prefix == "" {
+						return name
+					}
+					return prefix + strings.ToLower(buf.String())
+				}
+				return b, &Options{}
+			},
+		},
 		{
 			name: "skip--exported,tag",
 			args: []string{"--name", "foo"},
@@ -274,6 +470,31 @@ func TestBuilder_Build(t *testing.T) {
 				return b, &Options{LogLevel: logDefault, LogLevelDefault: logDefault, LogLevelPointer: &logDefault}
 			},
 		},
+		{
+			name: "customize--interface",
+			args: []string{"--log-level", "debug"},
+			want: `{"LogLevel":"DEBUG", "Nil": null}`,
+			create: func() (*flagstruct.Builder, interface{}) {
+				type Options struct {
+					LogLevel pflag.Value `flag:"log-level"`
+					Nil      pflag.Value `flag:"nil"` // skipped
+				}
+				logLevel := LogLevelInfo
+				return newBuilder(), &Options{LogLevel: &logLevel}
+			},
+		},
+		{
+			name: "customize--interface,nil",
+			args: []string{"--nil", "debug"},
+			want: `{}`,
+			create: func() (*flagstruct.Builder, interface{}) {
+				type Options struct {
+					Nil pflag.Value `flag:"nil"`
+				}
+				return newBuilder(), &Options{}
+			},
+			errorString: "unknown flag: --nil",
+		},
 		{
 			name: "nested",
 			args: []string{"--father.name", "foo"},
@@ -385,22 +606,67 @@ func TestBuilder_Build(t *testing.T) {
 			},
 		},
 
-		// MEMO: []struct[T] is impossible. maybe.
-		// {
-		// 	name: "nested,slice",
-		// 	args: []string{"--people.name", "foo"},
-		// 	want: `{"People": [{"Name": "moo"}, {"Name": "foo"}]}`,
-		// 	create: func() (*flagstruct.Builder, interface{}) {
-		// 		type Person struct {
-		// 			Name string `flag:"name"`
-		// 		}
-		// 		type Options struct {
-		// 			People []Person `flag:"people"`
-		// 		}
-		// 		b := newBuilder()
-		// 		return b, &Options{People: []Person{{Name: "moo"}}}
-		// 	},
-		// },
+		{
+			name: "nested,slice",
+			args: []string{"--people.1.name", "foo", "--people.1.age", "20"},
+			want: `{"People": [{"Age": 0, "Name": "moo"}, {"Age": 20, "Name": "foo"}]}`,
+			create: func() (*flagstruct.Builder, interface{}) {
+				type Person struct {
+					Age  int    `flag:"age"`
+					Name string `flag:"name"`
+				}
+				type Options struct {
+					People []Person `flag:"people"`
+				}
+				b := newBuilder()
+				return b, &Options{People: []Person{{Name: "moo"}}}
+			},
+		},
+		{
+			name: "nested,slice,grow",
+			args: []string{"--people.0.name", "foo", "--people.1.name=bar"},
+			want: `{"People": [{"Name": "foo"}, {"Name": "bar"}]}`,
+			create: func() (*flagstruct.Builder, interface{}) {
+				type Person struct {
+					Name string `flag:"name"`
+				}
+				type Options struct {
+					People []Person `flag:"people"`
+				}
+				b := newBuilder()
+				return b, &Options{}
+			},
+		},
+		{
+			name:        "nested,slice,out-of-range",
+			args:        []string{"--people.1000000000.name", "foo"},
+			errorString: `invalid argument "foo" for "--people.1000000000.name" flag: index 1000000000 is out of range (the next index is 0)`,
+			create: func() (*flagstruct.Builder, interface{}) {
+				type Person struct {
+					Name string `flag:"name"`
+				}
+				type Options struct {
+					People []Person `flag:"people"`
+				}
+				b := newBuilder()
+				return b, &Options{}
+			},
+		},
+		{
+			name:        "nested,slice,maxlen",
+			args:        []string{"--people.0.name", "foo", "--people.1.name", "bar"},
+			errorString: `invalid argument "bar" for "--people.1.name" flag: must have at most 1 elements, but 2`,
+			create: func() (*flagstruct.Builder, interface{}) {
+				type Person struct {
+					Name string `flag:"name"`
+				}
+				type Options struct {
+					People []Person `flag:"people" maxlen:"1"`
+				}
+				b := newBuilder()
+				return b, &Options{}
+			},
+		},
 	}
 
 	for _, tt := range tests {
@@ -434,29 +700,4353 @@ func TestBuilder_Build(t *testing.T) {
 	}
 }
 
-// test for enum
+func TestBuilder_Build_MaxDepth(t *testing.T) {
+	type C struct {
+		Name string `flag:"name"`
+	}
+	type B struct {
+		C C `flag:"c"`
+	}
+	type A struct {
+		B B `flag:"b"`
+	}
+	type Options struct {
+		A A `flag:"a"`
+	}
 
-type LogLevel string
+	newBuilder := func(maxDepth int) *flagstruct.Builder {
+		b := flagstruct.NewBuilder()
+		b.Name = "-"
+		b.EnvvarSupport = false
+		b.HandlingMode = pflag.ContinueOnError
+		b.MaxDepth = maxDepth
+		return b
+	}
 
-const (
-	LogLevelDebug   LogLevel = "DEBUG"
-	LogLevelInfo    LogLevel = "INFO"
-	LogLevelWarning LogLevel = "WARN"
-	LogLevelError   LogLevel = "ERROR"
-)
+	t.Run("ok", func(t *testing.T) {
+		options := &Options{}
+		fs := newBuilder(3).Build(options)
+		if err := fs.Parse([]string{"--a.b.c.name", "foo"}); err != nil {
+			t.Fatalf("unexpected error: %+v", err)
+		}
+		if want, got := "foo", options.A.B.C.Name; want != got {
+			t.Errorf("want %q, but got %q", want, got)
+		}
+	})
 
-func (v LogLevel) Validate() error {
-	switch v {
-	case "DEBUG", "INFO", "WARN", "ERROR":
-		return nil
-	default:
-		return fmt.Errorf("%v is an invalid value for %v", v, reflect.TypeOf(v))
+	t.Run("too-deep", func(t *testing.T) {
+		_, err := newBuilder(2).BuildE(&Options{})
+		if err == nil {
+			t.Fatalf("must be error, but nil")
+		}
+		if !strings.Contains(err.Error(), "too deep") {
+			t.Errorf("unexpected error: %q", err)
+		}
+	})
+}
+
+func TestBuilder_Build_DeeplyNestedNames(t *testing.T) {
+	// the prefix of the nested struct is not doubled (e.g. --a.b.c.name, not --a.a.b.c.name)
+	type C struct {
+		Name string `flag:"name"`
+	}
+	type B struct {
+		C C `flag:"c"`
+	}
+	type A struct {
+		B B `flag:"b"`
+	}
+	type Options struct {
+		A A `flag:"a"`
+	}
+
+	b := flagstruct.NewBuilder()
+	b.Name = "-"
+	b.EnvPrefix = "X_"
+	b.HandlingMode = pflag.ContinueOnError
+
+	options := &Options{}
+	fs := b.Build(options)
+	if want, got := []string{"X_A_B_C_NAME"}, fs.EnvVars(); !reflect.DeepEqual(want, got) {
+		t.Errorf("envvars, want %v, but got %v", want, got)
+	}
+	if fs.Lookup("a.b.c.name") == nil {
+		t.Errorf("--a.b.c.name must be defined")
+	}
+
+	t.Setenv("X_A_B_C_NAME", "foo")
+	if err := fs.Parse(nil); err != nil {
+		t.Fatalf("unexpected error: %+v", err)
+	}
+	if want, got := "foo", options.A.B.C.Name; want != got {
+		t.Errorf("want %q, but got %q", want, got)
 	}
 }
 
-// for flagstruct.HasHelpText
-func (v LogLevel) HelpText() string {
-	return "log level {DEBUG, INFO, WARN, ERROR}"
+func TestBuilder_Build_EnvHelpFormat(t *testing.T) {
+	type Options struct {
+		Name string `flag:"name" help:"name of greeting"`
+	}
+
+	tests := []struct {
+		name   string
+		format string
+		want   string
+	}{
+		{name: "default", format: flagstruct.DefaultConfig().EnvHelpFormat, want: "ENV: X_NAME\tname of greeting"},
+		{name: "custom", format: "[env: %s] ", want: "[env: X_NAME] name of greeting"},
+		{name: "omitted", format: "", want: "name of greeting"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := flagstruct.NewBuilder()
+			b.Name = "-"
+			b.EnvPrefix = "X_"
+			b.EnvHelpFormat = tt.format
+			b.HandlingMode = pflag.ContinueOnError
+
+			fs := b.Build(&Options{})
+			if got := fs.Lookup("name").Usage; tt.want != got {
+				t.Errorf("want %q, but got %q", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestFlagSet_Parse_ResponseFiles(t *testing.T) {
+	type Options struct {
+		Name    string   `flag:"name"`
+		Verbose bool     `flag:"verbose"`
+		Tags    []string `flag:"tag"`
+	}
+
+	newBuilder := func() *flagstruct.Builder {
+		b := flagstruct.NewBuilder()
+		b.Name = "-"
+		b.EnvvarSupport = false
+		b.HandlingMode = pflag.ContinueOnError
+		b.ExpandResponseFiles = true
+		return b
+	}
+
+	dir := t.TempDir()
+	writeFile := func(t *testing.T, name string, lines ...string) string {
+		t.Helper()
+		filename := filepath.Join(dir, name)
+		if err := os.WriteFile(filename, []byte(strings.Join(lines, "\n")), 0644); err != nil {
+			t.Fatalf("unexpected error: %+v", err)
+		}
+		return filename
+	}
+
+	t.Run("ok", func(t *testing.T) {
+		writeFile(t, "nested.txt", "--verbose", "--tag", "y")
+		filename := writeFile(t, "args.txt", "# comment", "--name", "foo", "", "@nested.txt")
+
+		options := &Options{}
+		fs := newBuilder().Build(options)
+		if err := fs.Parse([]string{"--tag", "x", "@" + filename, "--tag", "z"}); err != nil {
+			t.Fatalf("unexpected error: %+v", err)
+		}
+
+		want := `{"Name":"foo","Verbose":true,"Tags":["x","y","z"]}`
+		b, _ := json.Marshal(options)
+		if got := string(b); want != got {
+			t.Errorf("want %s, but got %s", want, got)
+		}
+	})
+
+	t.Run("recursive", func(t *testing.T) {
+		filename := writeFile(t, "recursive.txt", "--verbose", "@recursive.txt")
+
+		fs := newBuilder().Build(&Options{})
+		err := fs.Parse([]string{"@" + filename})
+		if err == nil {
+			t.Fatalf("must be error, but nil")
+		}
+		if !strings.Contains(err.Error(), "recursively") {
+			t.Errorf("unexpected error: %+v", err)
+		}
+	})
+}
+
+func TestBuilder_Build_CaseInsensitive(t *testing.T) {
+	type Options struct {
+		Name    string `flag:"name"`
+		Verbose bool
+		Nested  struct {
+			Value int `flag:"value"`
+		} `flag:"nested"`
+	}
+
+	newBuilder := func() *flagstruct.Builder {
+		b := flagstruct.NewBuilder()
+		b.Name = "-"
+		b.EnvPrefix = "X_"
+		b.HandlingMode = pflag.ContinueOnError
+		b.CaseInsensitive = true
+		return b
+	}
+
+	tests := []struct {
+		name string
+		args []string
+		env  map[string]string
+		want string
+	}{
+		{
+			name: "lower",
+			args: []string{"--name", "foo", "--verbose", "--nested.value", "10"},
+			want: `{"Name":"foo","Verbose":true,"Nested":{"Value":10}}`,
+		},
+		{
+			name: "mixed",
+			args: []string{"--Name", "foo", "--VERBOSE", "--Nested.Value=10"},
+			want: `{"Name":"foo","Verbose":true,"Nested":{"Value":10}}`,
+		},
+		{
+			name: "envvar",
+			args: []string{"--Verbose"},
+			env:  map[string]string{"X_NAME": "bar", "X_NESTED_VALUE": "20"},
+			want: `{"Name":"bar","Verbose":true,"Nested":{"Value":20}}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for k, v := range tt.env {
+				t.Setenv(k, v)
+			}
+
+			options := &Options{}
+			fs := newBuilder().Build(options)
+			if err := fs.Parse(tt.args); err != nil {
+				t.Fatalf("unexpected error: %+v", err)
+			}
+
+			b, _ := json.Marshal(options)
+			if got := string(b); tt.want != got {
+				t.Errorf("want %s, but got %s", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestBuilder_Build_AllowAbbrev(t *testing.T) {
+	type Options struct {
+		Name    string `flag:"name"`
+		Verbose bool   `flag:"verbose"`
+		Version bool   `flag:"version"`
+	}
+
+	newBuilder := func() *flagstruct.Builder {
+		b := flagstruct.NewBuilder()
+		b.Name = "-"
+		b.EnvvarSupport = false
+		b.HandlingMode = pflag.ContinueOnError
+		b.AllowAbbrev = true
+		return b
+	}
+
+	tests := []struct {
+		name string
+		args []string
+		want string
+
+		errorString string
+	}{
+		{
+			name: "exact",
+			args: []string{"--name", "foo", "--verbose"},
+			want: `{"Name":"foo","Verbose":true,"Version":false}`,
+		},
+		{
+			name: "unambiguous",
+			args: []string{"--na", "foo", "--verb"},
+			want: `{"Name":"foo","Verbose":true,"Version":false}`,
+		},
+		{
+			name: "unambiguous,with-equal",
+			args: []string{"--na=foo", "--vers"},
+			want: `{"Name":"foo","Verbose":false,"Version":true}`,
+		},
+		{
+			name: "value-is-not-abbreviated",
+			args: []string{"--name", "--ver"},
+			want: `{"Name":"--ver","Verbose":false,"Version":false}`,
+		},
+		{
+			name:        "ambiguous",
+			args:        []string{"--ver"},
+			errorString: "ambiguous flag: --ver (candidates: --verbose, --version)",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			options := &Options{}
+			fs := newBuilder().Build(options)
+			err := fs.Parse(tt.args)
+			if tt.errorString != "" {
+				if err == nil {
+					t.Fatalf("must be error, but nil")
+				}
+				if tt.errorString != err.Error() {
+					t.Fatalf("unexpected error: %+q\n\tbut expected message is %q", err.Error(), tt.errorString)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %+v", err)
+			}
+
+			b, _ := json.Marshal(options)
+			if got := string(b); tt.want != got {
+				t.Errorf("want %s, but got %s", tt.want, got)
+			}
+		})
+	}
+
+	t.Run("value-of-shorthand-is-not-abbreviated", func(t *testing.T) {
+		type Options struct {
+			Output  string `flag:"output" short:"o"`
+			Verbose bool   `flag:"verbose" short:"v"`
+		}
+
+		cases := []struct {
+			args []string
+			want string
+		}{
+			{args: []string{"-o", "--verb"}, want: `{"Output":"--verb","Verbose":false}`},
+			{args: []string{"-vo", "--verb"}, want: `{"Output":"--verb","Verbose":true}`},
+			{args: []string{"-ox", "--verb"}, want: `{"Output":"x","Verbose":true}`},
+			{args: []string{"-v", "--verb"}, want: `{"Output":"","Verbose":true}`},
+		}
+		for _, c := range cases {
+			options := &Options{}
+			fs := newBuilder().Build(options)
+			if err := fs.Parse(c.args); err != nil {
+				t.Fatalf("%v: unexpected error: %+v", c.args, err)
+			}
+			if b, _ := json.Marshal(options); c.want != string(b) {
+				t.Errorf("%v: want %s, but got %s", c.args, c.want, string(b))
+			}
+		}
+	})
+}
+
+func TestBuilder_Build_AllowAbbrev_WithHiddenFlags(t *testing.T) {
+	type Options struct {
+		Name    string        `flag:"name"`
+		Verbose bool          `flag:"verbose" negatable:"true"`
+		Timeout time.Duration `flag:"timeout" aliases:"ttl"`
+	}
+
+	tests := []struct {
+		name string
+		args []string
+		want string
+	}{
+		{
+			name: "alias-is-not-candidate",
+			args: []string{"--t", "1s"},
+			want: `{"Name":"","Verbose":false,"Timeout":1000000000}`,
+		},
+		{
+			name: "negative-is-not-candidate",
+			args: []string{"--n", "foo", "--verbose"},
+			want: `{"Name":"foo","Verbose":true,"Timeout":0}`,
+		},
+		{
+			name: "exact-alias-and-negative",
+			args: []string{"--ttl", "2s", "--verbose", "--no-verbose"},
+			want: `{"Name":"","Verbose":false,"Timeout":2000000000}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := flagstruct.NewBuilder()
+			b.Name = "-"
+			b.EnvvarSupport = false
+			b.HandlingMode = pflag.ContinueOnError
+			b.AllowAbbrev = true
+
+			options := &Options{}
+			fs := b.Build(options)
+			if err := fs.Parse(tt.args); err != nil {
+				t.Fatalf("unexpected error: %+v", err)
+			}
+
+			if b, _ := json.Marshal(options); tt.want != string(b) {
+				t.Errorf("want %s, but got %s", tt.want, string(b))
+			}
+		})
+	}
+}
+
+func TestFlagSet_Get(t *testing.T) {
+	type Options struct {
+		Name     string   `flag:"name"`
+		Age      int64    `flag:"age"`
+		LogLevel LogLevel `flag:"log-level"`
+		IP       *net.IP  `flag:"ip"`
+		Nested   struct {
+			Value int `flag:"value"`
+		} `flag:"nested"`
+		unexported string `flag:"unexported"`
+	}
+
+	b := flagstruct.NewBuilder()
+	b.Name = "-"
+	b.EnvvarSupport = false
+	b.HandlingMode = pflag.ContinueOnError
+
+	fs := b.Build(&Options{})
+	args := []string{"--name", "foo", "--age", "20", "--log-level", "debug", "--ip", "127.0.0.1", "--nested.value", "10", "--unexported", "bar"}
+	if err := fs.Parse(args); err != nil {
+		t.Fatalf("unexpected error: %+v", err)
+	}
+
+	t.Run("Get", func(t *testing.T) {
+		tests := []struct {
+			name string
+			want interface{}
+		}{
+			{name: "name", want: "foo"},
+			{name: "age", want: int64(20)},
+			{name: "log-level", want: LogLevelDebug},
+			{name: "nested.value", want: 10},
+			{name: "unexported", want: "bar"},
+		}
+		for _, tt := range tests {
+			got, err := fs.Get(tt.name)
+			if err != nil {
+				t.Errorf("unexpected error: %+v", err)
+				continue
+			}
+			if !reflect.DeepEqual(tt.want, got) {
+				t.Errorf("%s: want %#v, but got %#v", tt.name, tt.want, got)
+			}
+		}
+	})
+
+	t.Run("Get[T]", func(t *testing.T) {
+		ip, err := flagstruct.Get[*net.IP](fs, "ip")
+		if err != nil {
+			t.Fatalf("unexpected error: %+v", err)
+		}
+		if want, got := "127.0.0.1", ip.String(); want != got {
+			t.Errorf("want %q, but got %q", want, got)
+		}
+
+		if _, err := flagstruct.Get[int](fs, "name"); err == nil {
+			t.Errorf("must be error (type mismatch), but nil")
+		}
+		if _, err := flagstruct.Get[string](fs, "missing"); err == nil {
+			t.Errorf("must be error (not defined), but nil")
+		}
+	})
+
+	t.Run("pflag's getter", func(t *testing.T) {
+		age, err := fs.GetInt64("age")
+		if err != nil {
+			t.Fatalf("unexpected error: %+v", err)
+		}
+		if want, got := int64(20), age; want != got {
+			t.Errorf("want %d, but got %d", want, got)
+		}
+	})
+}
+
+func TestFlagSet_Parse_InteractivePrompt(t *testing.T) {
+	type Options struct {
+		Name     string `flag:"name" required:"true"`
+		Password string `flag:"password" required:"true" sensitive:"true"`
+		Verbose  bool   `flag:"verbose"`
+	}
+
+	var asked []flagstruct.FieldInfo
+	b := flagstruct.NewBuilder()
+	b.Name = "-"
+	b.EnvvarSupport = false
+	b.HandlingMode = pflag.ContinueOnError
+	b.InteractivePrompt = true
+	b.PromptFunc = func(field flagstruct.FieldInfo) (string, error) {
+		asked = append(asked, field)
+		return "secret", nil
+	}
+
+	options := &Options{}
+	fs := b.Build(options)
+	if err := fs.Parse([]string{"--name", "foo"}); err != nil {
+		t.Fatalf("unexpected error: %+v", err)
+	}
+
+	if want, got := 1, len(asked); want != got {
+		t.Fatalf("the number of prompts, want %d, but got %d", want, got)
+	}
+	if want, got := "password", asked[0].Name; want != got {
+		t.Errorf("prompted field, want %q, but got %q", want, got)
+	}
+	if !asked[0].Sensitive {
+		t.Errorf("prompted field must be sensitive")
+	}
+	want := `{"Name":"foo","Password":"secret","Verbose":false}`
+	if b, _ := json.Marshal(options); want != string(b) {
+		t.Errorf("want %s, but got %s", want, string(b))
+	}
+}
+
+func TestFlagSet_Sensitive(t *testing.T) {
+	type Options struct {
+		Name     string `flag:"name"`
+		Password string `flag:"password" sensitive:"true"`
+	}
+
+	b := flagstruct.NewBuilder()
+	b.Name = "-"
+	b.EnvvarSupport = false
+	b.HandlingMode = pflag.ContinueOnError
+
+	options := &Options{Name: "foo", Password: "default-password"}
+	fs := b.Build(options)
+
+	if usage := fs.FlagUsages(); strings.Contains(usage, "default-password") {
+		t.Errorf("the default value of sensitive flag must be masked in help\n%s", usage)
+	}
+
+	if err := fs.Parse([]string{"--password", "secret"}); err != nil {
+		t.Fatalf("unexpected error: %+v", err)
+	}
+	if want, got := "secret", options.Password; want != got {
+		t.Errorf("parsed value, want %q, but got %q", want, got)
+	}
+
+	if want, got := []string{"password"}, fs.Binder.AllSensitiveFlagNames(); !reflect.DeepEqual(want, got) {
+		t.Errorf("sensitive flag names, want %v, but got %v", want, got)
+	}
+
+	tests := []struct {
+		name string
+		want string
+	}{
+		{name: "name", want: "foo"},
+		{name: "password", want: flagstruct.SensitiveMask},
+	}
+	for _, tt := range tests {
+		got, err := fs.DisplayValue(tt.name)
+		if err != nil {
+			t.Errorf("unexpected error: %+v", err)
+			continue
+		}
+		if tt.want != got {
+			t.Errorf("%s: want %q, but got %q", tt.name, tt.want, got)
+		}
+	}
+}
+
+func TestBuilder_Build_EnvDisabled(t *testing.T) {
+	type Options struct {
+		Name  string `flag:"name" help:"name of greeting"`
+		Token string `flag:"token" help:"access token" env:"-"`
+	}
+
+	t.Setenv("X_NAME", "foo")
+	t.Setenv("X_TOKEN", "xxx")
+
+	b := flagstruct.NewBuilder()
+	b.Name = "-"
+	b.EnvPrefix = "X_"
+	b.HandlingMode = pflag.ContinueOnError
+
+	options := &Options{}
+	fs := b.Build(options)
+
+	if want, got := "ENV: X_NAME\tname of greeting", fs.Lookup("name").Usage; want != got {
+		t.Errorf("help text, want %q, but got %q", want, got)
+	}
+	if want, got := "access token", fs.Lookup("token").Usage; want != got {
+		t.Errorf("help text, want %q, but got %q", want, got)
+	}
+
+	if err := fs.Parse(nil); err != nil {
+		t.Fatalf("unexpected error: %+v", err)
+	}
+	want := `{"Name":"foo","Token":""}`
+	if b, _ := json.Marshal(options); want != string(b) {
+		t.Errorf("want %s, but got %s", want, string(b))
+	}
+}
+
+func TestFlagSet_Parse_AllowUnknownFlags(t *testing.T) {
+	type Options struct {
+		Name    string `flag:"name" short:"n"`
+		Verbose bool   `flag:"verbose" short:"v"`
+	}
+
+	newBuilder := func() *flagstruct.Builder {
+		b := flagstruct.NewBuilder()
+		b.Name = "-"
+		b.EnvvarSupport = false
+		b.HandlingMode = pflag.ContinueOnError
+		b.AllowUnknownFlags = true
+		return b
+	}
+
+	tests := []struct {
+		name        string
+		args        []string
+		want        string
+		wantUnknown []string
+		wantArgs    []string
+	}{
+		{
+			name:        "with-value",
+			args:        []string{"--name", "foo", "--foo", "bar", "-v", "x"},
+			want:        `{"Name":"foo","Verbose":true}`,
+			wantUnknown: []string{"--foo", "bar"},
+			wantArgs:    []string{"x"},
+		},
+		{
+			name:        "with-equal",
+			args:        []string{"--foo=bar", "-n", "foo", "--bar", "--verbose"},
+			want:        `{"Name":"foo","Verbose":true}`,
+			wantUnknown: []string{"--foo=bar", "--bar"},
+			wantArgs:    []string{},
+		},
+		{
+			name:        "short",
+			args:        []string{"-x", "1", "-nfoo", "--", "--foo"},
+			want:        `{"Name":"foo","Verbose":false}`,
+			wantUnknown: []string{"-x", "1"},
+			wantArgs:    []string{"--foo"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			options := &Options{}
+			fs := newBuilder().Build(options)
+			if err := fs.Parse(tt.args); err != nil {
+				t.Fatalf("unexpected error: %+v", err)
+			}
+
+			if b, _ := json.Marshal(options); tt.want != string(b) {
+				t.Errorf("want %s, but got %s", tt.want, string(b))
+			}
+			if want, got := tt.wantUnknown, fs.UnknownFlags(); !reflect.DeepEqual(want, got) {
+				t.Errorf("unknown flags, want %q, but got %q", want, got)
+			}
+			if want, got := tt.wantArgs, fs.Args(); !reflect.DeepEqual(want, got) {
+				t.Errorf("args, want %q, but got %q", want, got)
+			}
+		})
+	}
+}
+
+func TestFlagSet_Parse_Passthrough(t *testing.T) {
+	type Options struct {
+		Verbose bool     `flag:"verbose"`
+		Command []string `passthrough:"true"`
+	}
+
+	newBuilder := func() *flagstruct.Builder {
+		b := flagstruct.NewBuilder()
+		b.Name = "-"
+		b.EnvvarSupport = false
+		b.HandlingMode = pflag.ContinueOnError
+		return b
+	}
+
+	tests := []struct {
+		name     string
+		args     []string
+		want     string
+		wantArgs []string
+	}{
+		{
+			name:     "with-dash",
+			args:     []string{"--verbose", "x", "--", "ls", "-l", "--all"},
+			want:     `{"Verbose":true,"Command":["ls","-l","--all"]}`,
+			wantArgs: []string{"x", "ls", "-l", "--all"},
+		},
+		{
+			name:     "without-dash",
+			args:     []string{"--verbose", "x"},
+			want:     `{"Verbose":true,"Command":null}`,
+			wantArgs: []string{"x"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			options := &Options{}
+			fs := newBuilder().Build(options)
+			if fs.Lookup("Command") != nil {
+				t.Fatalf("passthrough field must not be a flag")
+			}
+			if err := fs.Parse(tt.args); err != nil {
+				t.Fatalf("unexpected error: %+v", err)
+			}
+
+			if b, _ := json.Marshal(options); tt.want != string(b) {
+				t.Errorf("want %s, but got %s", tt.want, string(b))
+			}
+			if want, got := tt.wantArgs, fs.Args(); !reflect.DeepEqual(want, got) {
+				t.Errorf("args, want %q, but got %q", want, got)
+			}
+		})
+	}
+}
+
+func TestBuilder_AddVersion(t *testing.T) {
+	type Options struct {
+		Verbose bool `flag:"verbose"`
+	}
+
+	b := flagstruct.NewBuilder()
+	b.Name = "-"
+	b.EnvvarSupport = false
+	b.HandlingMode = pflag.ContinueOnError
+	b.AddVersion("v0.0.0")
+
+	fs := b.Build(&Options{})
+	if err := fs.Parse([]string{"--verbose"}); err != nil {
+		t.Fatalf("unexpected error: %+v", err)
+	}
+
+	fs = b.Build(&Options{})
+	var buf strings.Builder
+	fs.SetOutput(&buf)
+	if err := fs.Parse([]string{"--version"}); !errors.Is(err, flagstruct.ErrVersion) {
+		t.Errorf("must be ErrVersion, but got %+v", err)
+	}
+	if want, got := "v0.0.0\n", buf.String(); want != got {
+		t.Errorf("the version must be written to the output, want %q, but got %q", want, got)
+	}
+}
+
+func TestFlagSet_GroupedFlagUsages(t *testing.T) {
+	type DB struct {
+		URI   string `flag:"uri" help:"uri of db"`
+		Debug bool   `flag:"debug" help:"debug flag"`
+	}
+	type Options struct {
+		Verbose bool `flag:"verbose" help:"verbose output"`
+		DB      DB   `flag:"db" group:"database options"`
+		Cache   DB   `flag:"cache"`
+	}
+
+	b := flagstruct.NewBuilder()
+	b.Name = "-"
+	b.EnvvarSupport = false
+	b.HandlingMode = pflag.ContinueOnError
+	b.GroupUsageByStruct = true
+
+	fs := b.Build(&Options{})
+	fs.SortFlags = false
+
+	want := strings.Join([]string{
+		"      --verbose   verbose output",
+		"",
+		"db (database options):",
+		"      --db.uri string   uri of db",
+		"      --db.debug        debug flag",
+		"",
+		"cache:",
+		"      --cache.uri string   uri of db",
+		"      --cache.debug        debug flag",
+		"",
+	}, "\n")
+	if got := fs.GroupedFlagUsages(); want != got {
+		t.Errorf("want\n%s\nbut got\n%s", want, got)
+	}
+
+	var buf strings.Builder
+	fs.SetOutput(&buf)
+	if err := fs.Parse([]string{"--help"}); !errors.Is(err, pflag.ErrHelp) {
+		t.Fatalf("must be ErrHelp, but got %+v", err)
+	}
+	if want, got := "Usage of -:\n"+want, buf.String(); want != got {
+		t.Errorf("want\n%s\nbut got\n%s", want, got)
+	}
+
+	t.Run("build-into", func(t *testing.T) {
+		var buf strings.Builder
+		outer := pflag.NewFlagSet("outer", pflag.ContinueOnError)
+		outer.SetOutput(&buf) // already set, before building
+
+		fs := b.BuildInto(outer, &Options{})
+		if err := fs.Parse([]string{"--help"}); !errors.Is(err, pflag.ErrHelp) {
+			t.Fatalf("must be ErrHelp, but got %+v", err)
+		}
+		if want, got := "Usage of -:\n", buf.String(); !strings.HasPrefix(got, want) || !strings.Contains(got, "db (database options):") {
+			t.Errorf("the grouped usage must be written to the output of the FlagSet, but got %q", got)
+		}
+	})
+}
+
+type defaulterDB struct {
+	URI string `flag:"uri"`
+}
+
+func (db *defaulterDB) SetDefaults() {
+	db.URI = "sqlite:///:memory:"
+}
+
+type defaulterOptions struct {
+	Name  string       `flag:"name"`
+	DB    defaulterDB  `flag:"db"`
+	Cache *defaulterDB `flag:"cache"`
+}
+
+func (o *defaulterOptions) SetDefaults() {
+	o.Name = "foo"
+	o.DB.URI = "sqlite:///data.db" // override the nested default
+}
+
+func TestBuilder_Build_Defaulter(t *testing.T) {
+	b := flagstruct.NewBuilder()
+	b.Name = "-"
+	b.EnvvarSupport = false
+	b.HandlingMode = pflag.ContinueOnError
+
+	options := &defaulterOptions{}
+	fs := b.Build(options)
+
+	usage := fs.FlagUsages()
+	for _, want := range []string{`(default "foo")`, `(default "sqlite:///data.db")`, `(default "sqlite:///:memory:")`} {
+		if !strings.Contains(usage, want) {
+			t.Errorf("help must include %s\n%s", want, usage)
+		}
+	}
+
+	if err := fs.Parse([]string{"--db.uri", "sqlite:///other.db"}); err != nil {
+		t.Fatalf("unexpected error: %+v", err)
+	}
+	want := `{"Name":"foo","DB":{"URI":"sqlite:///other.db"},"Cache":{"URI":"sqlite:///:memory:"}}`
+	if b, _ := json.Marshal(options); want != string(b) {
+		t.Errorf("want %s, but got %s", want, string(b))
+	}
+}
+
+func TestFlagSet_Explain(t *testing.T) {
+	type Options struct {
+		Name    string `flag:"name"`
+		Verbose bool   `flag:"verbose"`
+		Token   string `flag:"token"`
+	}
+
+	t.Setenv("X_TOKEN", "xxx")
+
+	b := flagstruct.NewBuilder()
+	b.Name = "-"
+	b.EnvPrefix = "X_"
+	b.HandlingMode = pflag.ContinueOnError
+
+	options := &Options{Name: "foo"}
+	fs := b.Build(options)
+	got, err := fs.Explain([]string{"--verbose"})
+	if err != nil {
+		t.Fatalf("unexpected error: %+v", err)
+	}
+
+	want := map[string]flagstruct.Source{
+		"name":    flagstruct.SourceDefault,
+		"verbose": flagstruct.SourceCommandLine,
+		"token":   flagstruct.SourceEnv,
+	}
+	if !reflect.DeepEqual(want, got) {
+		t.Errorf("want %v, but got %v", want, got)
+	}
+
+	// dry-run, the original struct is not modified
+	if _, err := fs.Explain([]string{"--name", "x"}); err != nil {
+		t.Fatalf("unexpected error: %+v", err)
+	}
+	wantJSON := `{"Name":"foo","Verbose":false,"Token":""}`
+	if b, _ := json.Marshal(options); wantJSON != string(b) {
+		t.Errorf("the bound struct must not be modified, want %s, but got %s", wantJSON, string(b))
+	}
+	if fs.Changed("name") {
+		t.Errorf("--name must not be changed")
+	}
+}
+
+func TestBuilder_BuildValue(t *testing.T) {
+	type Options struct {
+		Name    string `flag:"name"`
+		Verbose bool   `flag:"verbose"`
+	}
+
+	b := flagstruct.NewBuilder()
+	b.Name = "-"
+	b.EnvvarSupport = false
+	b.HandlingMode = pflag.ContinueOnError
+
+	value := Options{Name: "foo"}
+	fs, ob := b.BuildValue(value)
+	if err := fs.Parse([]string{"--verbose"}); err != nil {
+		t.Fatalf("unexpected error: %+v", err)
+	}
+
+	options, ok := ob.(*Options)
+	if !ok {
+		t.Fatalf("unexpected type: %T", ob)
+	}
+	if want, got := (Options{Name: "foo", Verbose: true}), *options; want != got {
+		t.Errorf("want %+v, but got %+v", want, got)
+	}
+	if want, got := (Options{Name: "foo"}), value; want != got {
+		t.Errorf("the original value must not be changed, want %+v, but got %+v", want, got)
+	}
+}
+
+func TestBuilder_Build_AllowNestedShorthand(t *testing.T) {
+	type DB struct {
+		URI   string `flag:"uri" short:"u"`
+		Debug bool   `flag:"debug" short:"d"`
+	}
+
+	newBuilder := func() *flagstruct.Builder {
+		b := flagstruct.NewBuilder()
+		b.Name = "-"
+		b.EnvvarSupport = false
+		b.HandlingMode = pflag.ContinueOnError
+		b.AllowNestedShorthand = true
+		return b
+	}
+
+	t.Run("ok", func(t *testing.T) {
+		type Options struct {
+			Verbose bool `flag:"verbose" short:"v"`
+			DB      DB   `flag:"db"`
+		}
+
+		options := &Options{}
+		fs := newBuilder().Build(options)
+		if err := fs.Parse([]string{"-u", "sqlite://", "-dv"}); err != nil {
+			t.Fatalf("unexpected error: %+v", err)
+		}
+		want := `{"Verbose":true,"DB":{"URI":"sqlite://","Debug":true}}`
+		if b, _ := json.Marshal(options); want != string(b) {
+			t.Errorf("want %s, but got %s", want, string(b))
+		}
+	})
+
+	t.Run("duplicated", func(t *testing.T) {
+		type Options struct {
+			Debug bool `flag:"debug" short:"d"`
+			DB    DB   `flag:"db"`
+		}
+
+		defer func() {
+			r := recover()
+			if r == nil {
+				t.Fatalf("must be panic, but not")
+			}
+			if want, got := `shorthand "d" of --db.debug (field Debug) is already used for --debug (field Debug)`, fmt.Sprintf("%v", r); want != got {
+				t.Errorf("unexpected panic message: %q", got)
+			}
+		}()
+		newBuilder().Build(&Options{})
+	})
+}
+
+func TestBuilder_BuildE(t *testing.T) {
+	newBuilder := func() *flagstruct.Builder {
+		b := flagstruct.NewBuilder()
+		b.Name = "-"
+		b.EnvvarSupport = false
+		b.HandlingMode = pflag.ContinueOnError
+		return b
+	}
+
+	t.Run("ok", func(t *testing.T) {
+		type Options struct {
+			Verbose bool `flag:"verbose" short:"v"`
+		}
+		fs, err := newBuilder().BuildE(&Options{})
+		if err != nil {
+			t.Fatalf("unexpected error: %+v", err)
+		}
+		if fs.ShorthandLookup("v") == nil {
+			t.Errorf("shorthand -v must be defined")
+		}
+	})
+
+	t.Run("shorthand-collision", func(t *testing.T) {
+		type Options struct {
+			Verbose bool `flag:"verbose" short:"v"`
+			Version bool `flag:"version" short:"v"`
+		}
+		_, err := newBuilder().BuildE(&Options{})
+		if err == nil {
+			t.Fatalf("must be error, but nil")
+		}
+		if want, got := `shorthand "v" of --version (field Version) is already used for --verbose (field Verbose)`, err.Error(); want != got {
+			t.Errorf("unexpected error: %q", got)
+		}
+	})
+}
+
+func TestBuilder_Build_AutoShorthand(t *testing.T) {
+	type Options struct {
+		Verbose bool   `flag:"verbose"`
+		Version bool   `flag:"version"` // conflicted with verbose
+		Name    string `flag:"name"`    // conflicted with number (explicit)
+		Number  int    `flag:"number" short:"n"`
+		Host    string `flag:"host"` // -h is for help
+		DB      struct {
+			URI string `flag:"uri"` // nested
+		} `flag:"db"`
+	}
+
+	b := flagstruct.NewBuilder()
+	b.Name = "-"
+	b.EnvvarSupport = false
+	b.HandlingMode = pflag.ContinueOnError
+	b.AutoShorthand = true
+
+	fs := b.Build(&Options{})
+	want := map[string]string{"verbose": "v", "version": "", "name": "", "number": "n", "host": "", "db.uri": ""}
+	for name, shorthand := range want {
+		if got := fs.Lookup(name).Shorthand; shorthand != got {
+			t.Errorf("shorthand of --%s, want %q, but got %q", name, shorthand, got)
+		}
+	}
+}
+
+func TestBuilder_Build_DefaultHelp(t *testing.T) {
+	type Options struct {
+		Token string `flag:"token" help:"access token" defaulthelp:"<from env>"`
+		Name  string `flag:"name" help:"name"`
+	}
+
+	b := flagstruct.NewBuilder()
+	b.Name = "-"
+	b.EnvvarSupport = false
+	b.HandlingMode = pflag.ContinueOnError
+
+	options := &Options{Token: "xxx", Name: "foo"}
+	fs := b.Build(options)
+
+	usage := fs.FlagUsages()
+	if want := `access token (default "<from env>")`; !strings.Contains(usage, want) {
+		t.Errorf("help must include %s\n%s", want, usage)
+	}
+	if want := `name (default "foo")`; !strings.Contains(usage, want) {
+		t.Errorf("help must include %s\n%s", want, usage)
+	}
+	if strings.Contains(usage, "xxx") {
+		t.Errorf("help must not include the actual default value\n%s", usage)
+	}
+
+	if err := fs.Parse(nil); err != nil {
+		t.Fatalf("unexpected error: %+v", err)
+	}
+	if want, got := "xxx", options.Token; want != got {
+		t.Errorf("the actual default value must not be changed, want %q, but got %q", want, got)
+	}
+}
+
+func TestBuilder_Build_AllowedValues(t *testing.T) {
+	type Options struct {
+		LogLevel LogLevel `flag:"log-level"`
+		Name     string   `flag:"name"`
+	}
+
+	b := flagstruct.NewBuilder()
+	b.Name = "-"
+	b.EnvvarSupport = false
+	b.HandlingMode = pflag.ContinueOnError
+
+	fs := b.Build(&Options{LogLevel: LogLevelInfo})
+
+	want := map[string][]string{
+		"log-level": {"DEBUG", "INFO", "WARN", "ERROR"},
+		"name":      nil,
+	}
+	for _, field := range fs.Binder.AllFields() {
+		if got := field.AllowedValues; !reflect.DeepEqual(want[field.Name], got) {
+			t.Errorf("allowed values of --%s, want %v, but got %v", field.Name, want[field.Name], got)
+		}
+	}
+
+	if want, usage := "(allowed: DEBUG, INFO, WARN, ERROR)", fs.Lookup("log-level").Usage; !strings.Contains(usage, want) {
+		t.Errorf("help must include %s, but got %q", want, usage)
+	}
+}
+
+func TestBuilder_BuildMany(t *testing.T) {
+	type ServerOptions struct {
+		Port int `flag:"port"`
+	}
+	type LoggingOptions struct {
+		LogLevel LogLevel `flag:"log-level"`
+		Verbose  bool     `flag:"verbose"`
+	}
+
+	newBuilder := func() *flagstruct.Builder {
+		b := flagstruct.NewBuilder()
+		b.Name = "-"
+		b.EnvvarSupport = false
+		b.HandlingMode = pflag.ContinueOnError
+		return b
+	}
+
+	t.Run("ok", func(t *testing.T) {
+		server := &ServerOptions{Port: 8080}
+		logging := &LoggingOptions{LogLevel: LogLevelInfo}
+
+		fs := newBuilder().BuildMany(server, logging)
+		if err := fs.Parse([]string{"--port", "3333", "--log-level", "debug"}); err != nil {
+			t.Fatalf("unexpected error: %+v", err)
+		}
+
+		if want, got := (ServerOptions{Port: 3333}), *server; want != got {
+			t.Errorf("want %+v, but got %+v", want, got)
+		}
+		if want, got := (LoggingOptions{LogLevel: LogLevelDebug}), *logging; want != got {
+			t.Errorf("want %+v, but got %+v", want, got)
+		}
+	})
+
+	t.Run("collision", func(t *testing.T) {
+		type AnotherOptions struct {
+			Verbose bool `flag:"verbose"`
+		}
+
+		defer func() {
+			r := recover()
+			if r == nil {
+				t.Fatalf("must be panic, but not")
+			}
+			if want, got := "flag --verbose (field Verbose) is already defined", fmt.Sprintf("%v", r); want != got {
+				t.Errorf("unexpected panic message: %q", got)
+			}
+		}()
+		newBuilder().BuildMany(&LoggingOptions{}, &AnotherOptions{})
+	})
+}
+
+func TestBuilder_BuildNamed(t *testing.T) {
+	type Options struct {
+		Verbose bool `flag:"verbose"`
+	}
+
+	b := flagstruct.NewBuilder()
+	b.Name = "app"
+	b.EnvvarSupport = false
+	b.HandlingMode = pflag.ContinueOnError
+
+	for _, name := range []string{"sub1", "sub2"} {
+		fs := b.BuildNamed(name, &Options{})
+
+		var buf strings.Builder
+		fs.SetOutput(&buf)
+		if err := fs.Parse([]string{"--help"}); !errors.Is(err, pflag.ErrHelp) {
+			t.Fatalf("must be ErrHelp, but got %+v", err)
+		}
+		if want, got := "Usage of "+name+":", buf.String(); !strings.HasPrefix(got, want) {
+			t.Errorf("usage header, want %q, but got %q", want, got)
+		}
+	}
+
+	if want, got := "app", b.Name; want != got {
+		t.Errorf("the builder must not be modified, want %q, but got %q", want, got)
+	}
+}
+
+func TestFlagSet_Parse_EnvvarSlice(t *testing.T) {
+	type Options struct {
+		Timeouts []time.Duration `flag:"timeouts"`
+		Nums     []int           `flag:"nums"`
+	}
+
+	t.Setenv("X_TIMEOUTS", "1s,2s,3s")
+	t.Setenv("X_NUMS", "1,2,3")
+
+	b := flagstruct.NewBuilder()
+	b.Name = "-"
+	b.EnvPrefix = "X_"
+	b.HandlingMode = pflag.ContinueOnError
+
+	options := &Options{Timeouts: []time.Duration{time.Minute}}
+	fs := b.Build(options)
+	if err := fs.Parse(nil); err != nil {
+		t.Fatalf("unexpected error: %+v", err)
+	}
+
+	if want, got := []time.Duration{time.Second, 2 * time.Second, 3 * time.Second}, options.Timeouts; !reflect.DeepEqual(want, got) {
+		t.Errorf("want %v, but got %v", want, got)
+	}
+	if want, got := []int{1, 2, 3}, options.Nums; !reflect.DeepEqual(want, got) {
+		t.Errorf("want %v, but got %v", want, got)
+	}
+}
+
+func TestFlagSet_EnvVars(t *testing.T) {
+	type Options struct {
+		Name  string `flag:"name"`
+		Token string `flag:"token" env:"-"`
+		DB    struct {
+			URI string `flag:"uri"`
+		} `flag:"db"`
+		Verbose bool `flag:"verbose"`
+	}
+
+	b := flagstruct.NewBuilder()
+	b.Name = "-"
+	b.EnvPrefix = "X_"
+	b.HandlingMode = pflag.ContinueOnError
+
+	fs := b.Build(&Options{})
+	if want, got := []string{"X_NAME", "X_DB_URI", "X_VERBOSE"}, fs.EnvVars(); !reflect.DeepEqual(want, got) {
+		t.Errorf("want %v, but got %v", want, got)
+	}
+
+	b.EnvvarSupport = false
+	fs = b.Build(&Options{})
+	if got := fs.EnvVars(); len(got) != 0 {
+		t.Errorf("must be empty (envvar is not supported), but got %v", got)
+	}
+}
+
+func TestBuilder_Build_HideZeroDefaults(t *testing.T) {
+	type Options struct {
+		Count    int        `flag:"count" help:"count"`
+		Retry    int        `flag:"retry" help:"retry"`
+		Rates    []float64  `flag:"rates" help:"rates"`
+		Weights  []float64  `flag:"weights" help:"weights"`
+		Disabled []bool     `flag:"disabled" help:"disabled"`
+		Since    time.Time  `flag:"since" help:"since"`
+		Until    time.Time  `flag:"until" help:"until"`
+		Point    complex128 `flag:"point" help:"point"`
+		Origin   complex128 `flag:"origin" help:"origin"`
+		At       time.Time  `flag:"at" help:"at" defaulthelp:"now"`
+	}
+
+	b := flagstruct.NewBuilder()
+	b.Name = "-"
+	b.EnvvarSupport = false
+	b.HandlingMode = pflag.ContinueOnError
+	b.HideZeroDefaults = true
+
+	until := time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)
+	options := &Options{Retry: 3, Weights: []float64{0.5}, Until: until, Origin: 1 + 2i}
+	fs := b.Build(options)
+
+	tests := []struct {
+		name        string
+		wantDefault string // empty is omitted
+	}{
+		{name: "count"},
+		{name: "retry", wantDefault: "(default 3)"},
+		{name: "rates"},
+		{name: "weights", wantDefault: "(default [0.500000])"},
+		{name: "disabled"},
+		{name: "since"},
+		{name: "until", wantDefault: "(default 2000-01-01T00:00:00Z)"},
+		{name: "point"},
+		{name: "origin", wantDefault: "(default (1+2i))"},
+		{name: "at", wantDefault: "(default now)"},
+	}
+
+	for _, line := range strings.Split(strings.TrimSpace(fs.FlagUsages()), "\n") {
+		for _, tt := range tests {
+			if !strings.Contains(line, "--"+tt.name+" ") {
+				continue
+			}
+			if tt.wantDefault == "" && strings.Contains(line, "(default") {
+				t.Errorf("--%s: default annotation must be omitted, but %q", tt.name, line)
+			}
+			if tt.wantDefault != "" && !strings.Contains(line, tt.wantDefault) {
+				t.Errorf("--%s: must include %s, but %q", tt.name, tt.wantDefault, line)
+			}
+		}
+	}
+
+	if err := fs.Parse([]string{"--rates", "0.1,0.2"}); err != nil {
+		t.Fatalf("unexpected error: %+v", err)
+	}
+	if want, got := []float64{0.1, 0.2}, options.Rates; !reflect.DeepEqual(want, got) {
+		t.Errorf("want %v, but got %v", want, got)
+	}
+
+	// the values are not changed, only the help is
+	if want, got := "0001-01-01T00:00:00Z", fs.Lookup("since").Value.String(); want != got {
+		t.Errorf("String(), want %q, but got %q", want, got)
+	}
+	if got, err := fs.DisplayValue("point"); err != nil || got != "(0+0i)" {
+		t.Errorf("DisplayValue(), want %q, but got %q (err=%v)", "(0+0i)", got, err)
+	}
+	var dst Options
+	if err := fs.Unmarshal(&dst); err != nil {
+		t.Fatalf("unexpected error on unmarshal: %+v", err)
+	}
+	if want, got := until, dst.Until; !want.Equal(got) {
+		t.Errorf("Unmarshal(), want %v, but got %v", want, got)
+	}
+	if want, got := []float64{0.1, 0.2}, dst.Rates; !reflect.DeepEqual(want, got) {
+		t.Errorf("Unmarshal(), want %v, but got %v", want, got)
+	}
+
+	var buf strings.Builder
+	fs.SetOutput(&buf)
+	if err := fs.Parse([]string{"--help"}); !errors.Is(err, pflag.ErrHelp) {
+		t.Fatalf("must be ErrHelp, but got %+v", err)
+	}
+	if strings.Contains(buf.String(), "(default 0001-01-01T00:00:00Z)") {
+		t.Errorf("the zero default must be omitted in usage, but %q", buf.String())
+	}
+}
+
+func TestFlagSet_HelpJSON(t *testing.T) {
+	type Options struct {
+		Name string `flag:"name" short:"n" help:"name of greeting" required:"true"`
+		DB   struct {
+			URI string `flag:"uri" help:"uri of db"`
+		} `flag:"db"`
+		LogLevel LogLevel `flag:"log-level" env:"-"`
+	}
+
+	b := flagstruct.NewBuilder()
+	b.Name = "-"
+	b.EnvPrefix = "X_"
+	b.HandlingMode = pflag.ContinueOnError
+
+	fs := b.Build(&Options{Name: "foo", LogLevel: LogLevelInfo})
+	output, err := fs.HelpJSON()
+	if err != nil {
+		t.Fatalf("unexpected error: %+v", err)
+	}
+
+	type flagHelp struct {
+		Name      string   `json:"name"`
+		Shorthand string   `json:"shorthand"`
+		Type      string   `json:"type"`
+		Default   string   `json:"default"`
+		Env       string   `json:"env"`
+		Help      string   `json:"help"`
+		Required  bool     `json:"required"`
+		Path      string   `json:"path"`
+		Allowed   []string `json:"allowed"`
+	}
+	var got []flagHelp
+	if err := json.Unmarshal(output, &got); err != nil {
+		t.Fatalf("unexpected error: %+v (unmarshal)\n%s", err, output)
+	}
+
+	want := []flagHelp{
+		{Name: "name", Shorthand: "n", Type: "string", Default: "foo", Env: "X_NAME", Help: "name of greeting", Required: true},
+		{Name: "db.uri", Type: "string", Default: "", Env: "X_DB_URI", Help: "uri of db", Path: "db"},
+		{Name: "log-level", Type: "LogLevel", Default: "INFO", Help: "log level {DEBUG, INFO, WARN, ERROR}", Allowed: []string{"DEBUG", "INFO", "WARN", "ERROR"}},
+	}
+	if !reflect.DeepEqual(want, got) {
+		t.Errorf("want\n\t%+v\nbut got\n\t%+v", want, got)
+	}
+}
+
+func TestBuilder_Build_TimeSlice(t *testing.T) {
+	type Options struct {
+		Holidays []time.Time `flag:"holidays" layout:"2006-01-02"`
+		Times    []time.Time `flag:"times"`
+	}
+
+	b := flagstruct.NewBuilder()
+	b.Name = "-"
+	b.EnvvarSupport = false
+	b.HandlingMode = pflag.ContinueOnError
+
+	options := &Options{Holidays: []time.Time{time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)}}
+	fs := b.Build(options)
+
+	if want, got := "[2023-01-01]", fs.Lookup("holidays").DefValue; want != got {
+		t.Errorf("default must be formatted with the layout, want %q, but got %q", want, got)
+	}
+
+	args := []string{"--holidays", "2024-01-01", "--holidays", "2024-12-25", "--times", "2024-01-01T00:00:00Z"}
+	if err := fs.Parse(args); err != nil {
+		t.Fatalf("unexpected error: %+v", err)
+	}
+
+	want := []time.Time{time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC), time.Date(2024, 12, 25, 0, 0, 0, 0, time.UTC)}
+	if got := options.Holidays; !reflect.DeepEqual(want, got) {
+		t.Errorf("want %v, but got %v", want, got)
+	}
+	if want, got := 1, len(options.Times); want != got {
+		t.Errorf("the number of times, want %d, but got %d", want, got)
+	}
+
+	if err := fs.Parse([]string{"--holidays", "12/25"}); err == nil {
+		t.Errorf("must be error (invalid layout), but nil")
+	}
+}
+
+func TestFlagSet_LookupByFieldPath(t *testing.T) {
+	type Base struct {
+		Debug bool `flag:"debug"`
+	}
+	type Options struct {
+		Base
+		DB struct {
+			Host string `flag:"host"`
+		} `flag:"database"`
+	}
+
+	b := flagstruct.NewBuilder()
+	b.Name = "-"
+	b.EnvvarSupport = false
+	b.HandlingMode = pflag.ContinueOnError
+
+	fs := b.Build(&Options{})
+
+	tests := []struct {
+		path string
+		want string // flag name (empty is not found)
+	}{
+		{path: "DB.Host", want: "database.host"},
+		{path: "Base.Debug", want: "debug"},
+		{path: "DB", want: ""}, // nested struct itself
+		{path: "Missing", want: ""},
+	}
+	for _, tt := range tests {
+		f := fs.LookupByFieldPath(tt.path)
+		got := ""
+		if f != nil {
+			got = f.Name
+		}
+		if tt.want != got {
+			t.Errorf("%s: want %q, but got %q", tt.path, tt.want, got)
+		}
+	}
+}
+
+func TestFlagSet_SetAll(t *testing.T) {
+	type Options struct {
+		Name    string   `flag:"name"`
+		Age     int      `flag:"age"`
+		Tags    []string `flag:"tag"`
+		Verbose bool     `flag:"verbose"`
+	}
+
+	newBuilder := func() *flagstruct.Builder {
+		b := flagstruct.NewBuilder()
+		b.Name = "-"
+		b.EnvvarSupport = false
+		b.HandlingMode = pflag.ContinueOnError
+		return b
+	}
+
+	t.Run("ok", func(t *testing.T) {
+		options := &Options{}
+		fs := newBuilder().Build(options)
+		err := fs.SetAll(map[string]string{"name": "foo", "age": "20", "tag": "x,y", "verbose": "true"})
+		if err != nil {
+			t.Fatalf("unexpected error: %+v", err)
+		}
+
+		want := `{"Name":"foo","Age":20,"Tags":["x","y"],"Verbose":true}`
+		if b, _ := json.Marshal(options); want != string(b) {
+			t.Errorf("want %s, but got %s", want, string(b))
+		}
+		if !fs.Changed("name") {
+			t.Errorf("--name must be changed")
+		}
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		fs := newBuilder().Build(&Options{})
+		err := fs.SetAll(map[string]string{"name": "foo", "age": "x", "missing": "y"})
+		if err == nil {
+			t.Fatalf("must be error, but nil")
+		}
+		for _, want := range []string{"on age=x", "on missing=y"} {
+			if !strings.Contains(err.Error(), want) {
+				t.Errorf("error must include %q, but got %q", want, err.Error())
+			}
+		}
+	})
+}
+
+func TestBuilder_Build_MixedFlagnameTags(t *testing.T) {
+	type Options struct {
+		Name    string `flag:"name" json:"-"`
+		Secret  string `json:"-"`
+		Verbose bool   `json:"verbose"`
+	}
+
+	cases := []struct {
+		msg     string
+		options []func(*flagstruct.Builder)
+		want    []string
+	}{
+		{msg: "flag only", want: []string{"Secret", "Verbose", "name"}},
+		{msg: "flag and json", options: []func(*flagstruct.Builder){flagstruct.WithMoreFlagnameTags("json")}, want: []string{"name", "verbose"}},
+	}
+
+	for _, c := range cases {
+		c := c
+		t.Run(c.msg, func(t *testing.T) {
+			b := flagstruct.NewBuilder()
+			b.Name = "-"
+			b.EnvvarSupport = false
+			for _, opt := range c.options {
+				opt(b)
+			}
+			fs := b.Build(&Options{})
+
+			var got []string
+			fs.VisitAll(func(f *pflag.Flag) {
+				got = append(got, f.Name)
+			})
+			if !reflect.DeepEqual(c.want, got) {
+				t.Errorf("want flags %v, but got %v", c.want, got)
+			}
+		})
+	}
+}
+
+func TestFlagSet_Parse_EnvvarError(t *testing.T) {
+	type Options struct {
+		LogLevel LogLevel `flag:"log-level"`
+		Token    int      `flag:"token" sensitive:"true"`
+	}
+
+	newBuilder := func() *flagstruct.Builder {
+		b := flagstruct.NewBuilder()
+		b.Name = "-"
+		b.HandlingMode = pflag.ContinueOnError
+		return b
+	}
+
+	t.Run("enum", func(t *testing.T) {
+		t.Setenv("LOG_LEVEL", "bogus")
+		fs := newBuilder().Build(&Options{LogLevel: LogLevelInfo})
+		err := fs.Parse(nil)
+		if err == nil {
+			t.Fatalf("must be error, but nil")
+		}
+		for _, want := range []string{`LOG_LEVEL="bogus"`, "--log-level", "BOGUS is an invalid value"} {
+			if !strings.Contains(err.Error(), want) {
+				t.Errorf("error must include %q, but got %q", want, err.Error())
+			}
+		}
+	})
+
+	t.Run("sensitive", func(t *testing.T) {
+		t.Setenv("TOKEN", "s3cret")
+		fs := newBuilder().Build(&Options{LogLevel: LogLevelInfo})
+		err := fs.Parse(nil)
+		if err == nil {
+			t.Fatalf("must be error, but nil")
+		}
+		if !strings.Contains(err.Error(), "TOKEN") {
+			t.Errorf("error must include the envvar name, but got %q", err.Error())
+		}
+		if strings.Contains(err.Error(), "s3cret") {
+			t.Errorf("error must not include the sensitive value, but got %q", err.Error())
+		}
+	})
+}
+
+func TestBuilder_Build_IncludeAllExported(t *testing.T) {
+	type Inner struct {
+		Debug bool `flag:"debug"`
+	}
+	type Options struct {
+		Inner
+		Name    string `flag:"name"`
+		Verbose bool
+		secret  string `flag:"secret"`
+	}
+
+	cases := []struct {
+		msg                string
+		includeAllExported bool
+		want               []string
+	}{
+		{msg: "include", includeAllExported: true, want: []string{"Verbose", "debug", "name", "secret"}},
+		{msg: "tagged only", includeAllExported: false, want: []string{"debug", "name", "secret"}},
+	}
+
+	for _, c := range cases {
+		c := c
+		t.Run(c.msg, func(t *testing.T) {
+			b := flagstruct.NewBuilder()
+			b.Name = "-"
+			b.EnvvarSupport = false
+			b.IncludeAllExported = c.includeAllExported
+			fs := b.Build(&Options{})
+
+			var got []string
+			fs.VisitAll(func(f *pflag.Flag) {
+				got = append(got, f.Name)
+			})
+			if !reflect.DeepEqual(c.want, got) {
+				t.Errorf("want flags %v, but got %v", c.want, got)
+			}
+		})
+	}
+}
+
+func TestBuilder_Build_PanicOnUnexportedTagged(t *testing.T) {
+	type Options struct {
+		Name   string `flag:"name"`
+		secret string `flag:"secret"`
+	}
+
+	t.Run("default", func(t *testing.T) {
+		b := flagstruct.NewBuilder()
+		b.Name = "-"
+		b.EnvvarSupport = false
+		b.HandlingMode = pflag.ContinueOnError
+
+		options := &Options{}
+		fs := b.Build(options)
+		if err := fs.Parse([]string{"--secret", "foo"}); err != nil {
+			t.Fatalf("unexpected error: %+v", err)
+		}
+		if want, got := "foo", options.secret; want != got {
+			t.Errorf("want %q, but got %q", want, got)
+		}
+	})
+
+	t.Run("panic", func(t *testing.T) {
+		b := flagstruct.NewBuilder()
+		b.Name = "-"
+		b.EnvvarSupport = false
+		b.PanicOnUnexportedTagged = true
+
+		defer func() {
+			r := recover()
+			if r == nil {
+				t.Fatalf("must panic, but not")
+			}
+			if msg := fmt.Sprint(r); !strings.Contains(msg, "secret") {
+				t.Errorf("panic message must include the field name, but got %q", msg)
+			}
+		}()
+		b.Build(&Options{})
+	})
+}
+
+func TestBuilder_Build_Complex(t *testing.T) {
+	type Options struct {
+		Z   complex128 `flag:"z"`
+		Z64 complex64  `flag:"z64"`
+	}
+
+	b := flagstruct.NewBuilder()
+	b.Name = "-"
+	b.EnvvarSupport = false
+	b.HandlingMode = pflag.ContinueOnError
+
+	options := &Options{Z: 1 + 1i}
+	fs := b.Build(options)
+	if want, got := "(1+1i)", fs.Lookup("z").DefValue; want != got {
+		t.Errorf("default: want %q, but got %q", want, got)
+	}
+
+	if err := fs.Parse([]string{"--z", "1.5-2i", "--z64", "-3-0.5i"}); err != nil {
+		t.Fatalf("unexpected error: %+v", err)
+	}
+	if want, got := complex(1.5, -2), options.Z; want != got {
+		t.Errorf("z: want %v, but got %v", want, got)
+	}
+	if want, got := complex64(complex(-3, -0.5)), options.Z64; want != got {
+		t.Errorf("z64: want %v, but got %v", want, got)
+	}
+
+	if err := fs.Set("z", "1+"); err == nil {
+		t.Errorf("must be error, but nil")
+	}
+}
+
+func TestBuilder_Build_OnFlagRegistered(t *testing.T) {
+	type DB struct {
+		URI string `flag:"uri"`
+	}
+	type Options struct {
+		Name    string `flag:"name"`
+		Verbose bool   `flag:"verbose" negatable:"true"`
+		DB      DB     `flag:"db"`
+		Debug   bool   `flag:"debug" internal:"true"`
+	}
+
+	b := flagstruct.NewBuilder()
+	b.Name = "-"
+	b.EnvvarSupport = false
+
+	var names []string
+	b.OnFlagRegistered = func(f *pflag.Flag, field reflect.StructField) {
+		names = append(names, f.Name)
+		if ok, _ := strconv.ParseBool(field.Tag.Get("internal")); ok {
+			f.Hidden = true
+		}
+	}
+	fs := b.Build(&Options{})
+
+	if want, got := []string{"name", "no-verbose", "verbose", "db.uri", "debug"}, names; !reflect.DeepEqual(want, got) {
+		t.Errorf("want %v, but got %v", want, got)
+	}
+	if !fs.Lookup("debug").Hidden {
+		t.Errorf("--debug must be hidden")
+	}
+}
+
+type Mode int
+
+const (
+	ModeFast Mode = iota
+	ModeSlow
+)
+
+func (m Mode) String() string {
+	switch m {
+	case ModeFast:
+		return "fast"
+	case ModeSlow:
+		return "slow"
+	default:
+		return fmt.Sprintf("Mode(%d)", int(m))
+	}
+}
+
+func TestBuilder_Build_StringerDefault(t *testing.T) {
+	type Options struct {
+		Mode Mode `flag:"mode"`
+	}
+
+	b := flagstruct.NewBuilder()
+	b.Name = "-"
+	b.EnvvarSupport = false
+	b.HandlingMode = pflag.ContinueOnError
+
+	options := &Options{Mode: ModeSlow}
+	fs := b.Build(options)
+	if want, got := "slow", fs.Lookup("mode").DefValue; want != got {
+		t.Errorf("default: want %q, but got %q", want, got)
+	}
+
+	if err := fs.Parse([]string{"--mode", "0"}); err != nil {
+		t.Fatalf("unexpected error: %+v", err)
+	}
+	if want, got := ModeFast, options.Mode; want != got {
+		t.Errorf("want %v, but got %v", want, got)
+	}
+}
+
+func TestFlagSet_Unmarshal(t *testing.T) {
+	type CLIOptions struct {
+		Name    string   `flag:"name"`
+		Port    int      `flag:"port"`
+		Tags    []string `flag:"tag"`
+		Verbose bool     `flag:"verbose"`
+	}
+	type Config struct {
+		ServerName string   `flag:"name" json:"name"`
+		Port       int      `flag:"port" json:"port"`
+		Labels     []string `flag:"tag" json:"labels"`
+		Other      string   `flag:"-" json:"other"`
+	}
+
+	b := flagstruct.NewBuilder()
+	b.Name = "-"
+	b.EnvvarSupport = false
+	b.HandlingMode = pflag.ContinueOnError
+
+	fs := b.Build(&CLIOptions{Port: 8080})
+	if err := fs.Parse([]string{"--name", "foo", "--tag", "x,y", "--tag", "z"}); err != nil {
+		t.Fatalf("unexpected error: %+v", err)
+	}
+
+	dst := &Config{Other: "bar"}
+	if err := fs.Unmarshal(dst); err != nil {
+		t.Fatalf("unexpected error: %+v", err)
+	}
+
+	want := `{"name":"foo","port":8080,"labels":["x","y","z"],"other":"bar"}`
+	if b, _ := json.Marshal(dst); want != string(b) {
+		t.Errorf("want %s, but got %s", want, string(b))
+	}
+}
+
+func TestBuilder_BuildWithDefaults(t *testing.T) {
+	type DB struct {
+		URI string `flag:"uri"`
+	}
+	type Options struct {
+		Name string   `flag:"name"`
+		Tags []string `flag:"tag"`
+		DB   *DB      `flag:"db"`
+	}
+
+	b := flagstruct.NewBuilder()
+	b.Name = "-"
+	b.EnvvarSupport = false
+	b.HandlingMode = pflag.ContinueOnError
+
+	defaults := Options{Name: "foo", Tags: []string{"x"}, DB: &DB{URI: "sqlite://"}}
+	options := &Options{}
+	fs := b.BuildWithDefaults(options, defaults)
+
+	if want, got := "foo", fs.Lookup("name").DefValue; want != got {
+		t.Errorf("default: want %q, but got %q", want, got)
+	}
+	if err := fs.Parse([]string{"--db.uri", "mysql://"}); err != nil {
+		t.Fatalf("unexpected error: %+v", err)
+	}
+
+	want := `{"Name":"foo","Tags":["x"],"DB":{"URI":"mysql://"}}`
+	if b, _ := json.Marshal(options); want != string(b) {
+		t.Errorf("want %s, but got %s", want, string(b))
+	}
+	if want, got := "sqlite://", defaults.DB.URI; want != got {
+		t.Errorf("defaults must not be modified: want %q, but got %q", want, got)
+	}
+}
+
+func TestBuilder_Build_LazyPointerAlloc(t *testing.T) {
+	type Options struct {
+		Port    *int           `flag:"port"`
+		Name    *string        `flag:"name"`
+		Verbose *bool          `flag:"verbose"`
+		Timeout *time.Duration `flag:"timeout"`
+		Tags    *[]string      `flag:"tag"` // not supported, allocated eagerly
+	}
+
+	b := flagstruct.NewBuilder()
+	b.Name = "-"
+	b.EnvvarSupport = false
+	b.HandlingMode = pflag.ContinueOnError
+	b.LazyPointerAlloc = true
+
+	options := &Options{}
+	fs := b.Build(options)
+	if err := fs.Parse([]string{"--name", "foo", "--verbose", "--timeout", "1s", "--tag", "x", "--tag", "y"}); err != nil {
+		t.Fatalf("unexpected error: %+v", err)
+	}
+
+	if options.Port != nil {
+		t.Errorf("unset --port must be nil, but got %v", *options.Port)
+	}
+	want := `{"Port":null,"Name":"foo","Verbose":true,"Timeout":1000000000,"Tags":["x","y"]}`
+	if b, _ := json.Marshal(options); want != string(b) {
+		t.Errorf("want %s, but got %s", want, string(b))
+	}
+}
+
+func TestBuilder_Build_Optional(t *testing.T) {
+	type Options struct {
+		Timeout flagstruct.Optional[time.Duration] `flag:"timeout"`
+		Retry   flagstruct.Optional[int]           `flag:"retry"`
+		Verbose flagstruct.Optional[bool]          `flag:"verbose"`
+	}
+
+	cases := []struct {
+		msg  string
+		args []string
+		want string
+	}{
+		{
+			msg:  "unset",
+			args: nil,
+			want: `{"Timeout":{"Value":0,"Valid":false},"Retry":{"Value":3,"Valid":false},"Verbose":{"Value":false,"Valid":false}}`,
+		},
+		{
+			msg:  "set",
+			args: []string{"--timeout", "0s", "--retry", "3", "--verbose"},
+			want: `{"Timeout":{"Value":0,"Valid":true},"Retry":{"Value":3,"Valid":true},"Verbose":{"Value":true,"Valid":true}}`,
+		},
+	}
+
+	for _, c := range cases {
+		c := c
+		t.Run(c.msg, func(t *testing.T) {
+			b := flagstruct.NewBuilder()
+			b.Name = "-"
+			b.EnvvarSupport = false
+			b.HandlingMode = pflag.ContinueOnError
+
+			options := &Options{}
+			options.Retry.Value = 3
+			fs := b.Build(options)
+			if err := fs.Parse(c.args); err != nil {
+				t.Fatalf("unexpected error: %+v", err)
+			}
+			if b, _ := json.Marshal(options); c.want != string(b) {
+				t.Errorf("want %s, but got %s", c.want, string(b))
+			}
+		})
+	}
+}
+
+func TestFlagSet_LoadYAMLDefaults(t *testing.T) {
+	type DB struct {
+		URI string `flag:"uri" json:"uri"`
+	}
+	type Options struct {
+		Name string   `flag:"name" json:"name"`
+		Port int      `flag:"port" json:"port"`
+		Tags []string `flag:"tag" json:"tags"`
+		DB   DB       `flag:"db" json:"db"`
+	}
+
+	// fake YAML decoder (the test data is written in JSON, a subset of YAML)
+	unmarshaler := func(data []byte, v interface{}) error {
+		return json.Unmarshal(data, v)
+	}
+
+	filename := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(filename, []byte(`{"name": "from-config", "port": 8888, "tags": ["a", "b"], "db": {"uri": "sqlite://"}}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	b := flagstruct.NewBuilder()
+	b.Name = "-"
+	b.EnvvarSupport = false
+	b.HandlingMode = pflag.ContinueOnError
+	b.Unmarshaler = unmarshaler
+
+	options := &Options{Port: 8080}
+	fs := b.Build(options)
+	if err := fs.Parse([]string{"--name", "from-cli", "--tag", "x"}); err != nil {
+		t.Fatalf("unexpected error: %+v", err)
+	}
+	if err := fs.LoadYAMLDefaults(filename); err != nil {
+		t.Fatalf("unexpected error: %+v", err)
+	}
+
+	want := `{"name":"from-cli","port":8888,"tags":["x"],"db":{"uri":"sqlite://"}}`
+	if b, _ := json.Marshal(options); want != string(b) {
+		t.Errorf("want %s, but got %s", want, string(b))
+	}
+	if want, got := "8888", fs.Lookup("port").DefValue; want != got {
+		t.Errorf("default: want %q, but got %q", want, got)
+	}
+
+	t.Run("without unmarshaler", func(t *testing.T) {
+		b := flagstruct.NewBuilder()
+		b.Name = "-"
+		b.EnvvarSupport = false
+		fs := b.Build(&Options{})
+		if err := fs.LoadYAMLDefaults(filename); err == nil {
+			t.Errorf("must be error, but nil")
+		}
+	})
+}
+
+func TestFlagSet_LoadConfig(t *testing.T) {
+	type Options struct {
+		Name string `flag:"name" json:"name"`
+		Port int    `flag:"port" json:"port"`
+	}
+
+	dir := t.TempDir()
+	writeFile := func(name string, content string) string {
+		filename := filepath.Join(dir, name)
+		if err := os.WriteFile(filename, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return filename
+	}
+
+	// fake decoder for "key=value" lines
+	decodeKV := func(data []byte, v interface{}) error {
+		m := map[string]interface{}{}
+		for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+			parts := strings.SplitN(line, "=", 2)
+			if n, err := strconv.Atoi(parts[1]); err == nil {
+				m[parts[0]] = n
+			} else {
+				m[parts[0]] = parts[1]
+			}
+		}
+		b, err := json.Marshal(m)
+		if err != nil {
+			return err
+		}
+		return json.Unmarshal(b, v)
+	}
+
+	cases := []struct {
+		msg      string
+		filename string
+		want     string
+	}{
+		{msg: "json", filename: writeFile("config.json", `{"name": "json", "port": 1}`), want: `{"name":"json","port":1}`},
+		{msg: "custom", filename: writeFile("config.KV", "name=kv\nport=2"), want: `{"name":"kv","port":2}`},
+	}
+
+	for _, c := range cases {
+		c := c
+		t.Run(c.msg, func(t *testing.T) {
+			b := flagstruct.NewBuilder()
+			b.Name = "-"
+			b.EnvvarSupport = false
+			b.HandlingMode = pflag.ContinueOnError
+			b.ConfigDecoders[".kv"] = decodeKV
+
+			options := &Options{}
+			fs := b.Build(options)
+			if err := fs.Parse(nil); err != nil {
+				t.Fatalf("unexpected error: %+v", err)
+			}
+			if err := fs.LoadConfig(c.filename); err != nil {
+				t.Fatalf("unexpected error: %+v", err)
+			}
+			if b, _ := json.Marshal(options); c.want != string(b) {
+				t.Errorf("want %s, but got %s", c.want, string(b))
+			}
+		})
+	}
+
+	t.Run("unknown extension", func(t *testing.T) {
+		b := flagstruct.NewBuilder()
+		b.Name = "-"
+		b.EnvvarSupport = false
+		fs := b.Build(&Options{})
+		if err := fs.LoadConfig(writeFile("config.toml", "")); err == nil {
+			t.Errorf("must be error, but nil")
+		}
+	})
+}
+
+func TestFlagSet_Parse_NumericSlice(t *testing.T) {
+	type Options struct {
+		Ints    []int     `flag:"ints"`
+		Int64s  []int64   `flag:"int64s"`
+		Floats  []float64 `flag:"floats"`
+		Uints   []uint    `flag:"uints"`
+		Default []int     `flag:"default"`
+	}
+
+	cases := []struct {
+		msg  string
+		args []string
+		envs map[string]string
+	}{
+		{
+			msg:  "comma-joined",
+			args: []string{"--ints", "1,2,3", "--int64s", "1,2,3", "--floats", "1.5,2,3", "--uints", "1,2,3", "--default", "1,2,3"},
+		},
+		{
+			msg: "repeated",
+			args: []string{
+				"--ints", "1", "--ints", "2", "--ints", "3",
+				"--int64s", "1", "--int64s", "2", "--int64s", "3",
+				"--floats", "1.5", "--floats", "2", "--floats", "3",
+				"--uints", "1", "--uints", "2", "--uints", "3",
+				"--default", "1", "--default", "2,3",
+			},
+		},
+		{
+			msg:  "envvar",
+			envs: map[string]string{"INTS": "1,2,3", "INT64S": "1,2,3", "FLOATS": "1.5,2,3", "UINTS": "1,2,3", "DEFAULT": "1,2,3"},
+		},
+	}
+
+	want := `{"Ints":[1,2,3],"Int64s":[1,2,3],"Floats":[1.5,2,3],"Uints":[1,2,3],"Default":[1,2,3]}`
+	for _, c := range cases {
+		c := c
+		t.Run(c.msg, func(t *testing.T) {
+			for k, v := range c.envs {
+				t.Setenv(k, v)
+			}
+
+			b := flagstruct.NewBuilder()
+			b.Name = "-"
+			b.EnvvarSupport = len(c.envs) > 0
+			b.HandlingMode = pflag.ContinueOnError
+
+			options := &Options{Default: []int{10}}
+			fs := b.Build(options)
+			if err := fs.Parse(c.args); err != nil {
+				t.Fatalf("unexpected error: %+v", err)
+			}
+			if b, _ := json.Marshal(options); want != string(b) {
+				t.Errorf("want %s, but got %s", want, string(b))
+			}
+		})
+	}
+}
+
+func TestFlagSet_Terminate(t *testing.T) {
+	type Options struct {
+		ListPlugins bool   `flag:"list-plugins"`
+		Doctor      bool   `flag:"doctor"`
+		Name        string `flag:"name"`
+	}
+
+	cases := []struct {
+		msg    string
+		args   []string
+		want   string
+		called []string
+	}{
+		{msg: "not terminated", args: []string{"--name", "foo"}},
+		{msg: "terminated", args: []string{"--doctor"}, want: "doctor", called: []string{"doctor"}},
+		{msg: "declaration order", args: []string{"--doctor", "--list-plugins"}, want: "list-plugins", called: []string{"list-plugins"}},
+	}
+
+	for _, c := range cases {
+		c := c
+		t.Run(c.msg, func(t *testing.T) {
+			b := flagstruct.NewBuilder()
+			b.Name = "-"
+			b.EnvvarSupport = false
+			b.HandlingMode = pflag.ContinueOnError
+
+			var called []string
+			fs := b.Build(&Options{})
+			for _, name := range []string{"list-plugins", "doctor"} {
+				name := name
+				fs.Terminate(name, func(fs *flagstruct.FlagSet) error {
+					called = append(called, name)
+					return nil
+				})
+			}
+
+			err := fs.Parse(c.args)
+			if c.want == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %+v", err)
+				}
+			} else {
+				var terminated *flagstruct.ErrTerminated
+				if !errors.As(err, &terminated) {
+					t.Fatalf("must be ErrTerminated, but got %+v", err)
+				}
+				if want, got := c.want, terminated.Flag; want != got {
+					t.Errorf("want %q, but got %q", want, got)
+				}
+			}
+			if !reflect.DeepEqual(c.called, called) {
+				t.Errorf("called: want %v, but got %v", c.called, called)
+			}
+		})
+	}
+}
+
+func TestFlagSet_Parse_Glob(t *testing.T) {
+	type Options struct {
+		Files []string `flag:"file" glob:"true"`
+		Raw   []string `flag:"raw"`
+	}
+
+	dir := t.TempDir()
+	for _, name := range []string{"a.go", "b.go", "c.txt"} {
+		if err := os.WriteFile(filepath.Join(dir, name), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cases := []struct {
+		msg  string
+		keep bool
+		want []string
+	}{
+		{msg: "drop unmatched", want: []string{filepath.Join(dir, "a.go"), filepath.Join(dir, "b.go"), "x.txt"}},
+		{msg: "keep unmatched", keep: true, want: []string{filepath.Join(dir, "a.go"), filepath.Join(dir, "b.go"), filepath.Join(dir, "*.md"), "x.txt"}},
+	}
+
+	for _, c := range cases {
+		c := c
+		t.Run(c.msg, func(t *testing.T) {
+			b := flagstruct.NewBuilder()
+			b.Name = "-"
+			b.EnvvarSupport = false
+			b.HandlingMode = pflag.ContinueOnError
+			b.KeepUnmatchedGlob = c.keep
+
+			options := &Options{}
+			fs := b.Build(options)
+			args := []string{"--file", filepath.Join(dir, "*.go"), "--file", filepath.Join(dir, "*.md"), "--file", "x.txt", "--raw", "*.go"}
+			if err := fs.Parse(args); err != nil {
+				t.Fatalf("unexpected error: %+v", err)
+			}
+			if !reflect.DeepEqual(c.want, options.Files) {
+				t.Errorf("want %v, but got %v", c.want, options.Files)
+			}
+			if want, got := []string{"*.go"}, options.Raw; !reflect.DeepEqual(want, got) {
+				t.Errorf("raw: want %v, but got %v", want, got)
+			}
+		})
+	}
+}
+
+func TestFlagSet_Validate(t *testing.T) {
+	type Options struct {
+		LogLevel      LogLevel  `flag:"log-level"`
+		OtherLogLevel *LogLevel `flag:"other-log-level"`
+		Name          string    `flag:"name"`
+	}
+
+	b := flagstruct.NewBuilder()
+	b.Name = "-"
+	b.EnvvarSupport = false
+	b.HandlingMode = pflag.ContinueOnError
+
+	other := LogLevelInfo
+	options := &Options{LogLevel: LogLevelInfo, OtherLogLevel: &other}
+	fs := b.Build(options)
+	if err := fs.Parse([]string{"--log-level", "debug", "--other-log-level", "warn"}); err != nil {
+		t.Fatalf("unexpected error: %+v", err)
+	}
+	if err := fs.Validate(); err != nil {
+		t.Fatalf("unexpected error: %+v", err)
+	}
+
+	options.LogLevel = "bogus"
+	*options.OtherLogLevel = "bogus"
+	err := fs.Validate()
+	if err == nil {
+		t.Fatalf("must be error, but nil")
+	}
+	for _, want := range []string{"on --log-level", "on --other-log-level", "bogus is an invalid value"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error must include %q, but got %q", want, err.Error())
+		}
+	}
+}
+
+func TestFlagSet_Parse_EnvListSeparator(t *testing.T) {
+	type Options struct {
+		Dirs []string `flag:"dirs"`
+		Nums []int    `flag:"nums"`
+		Name string   `flag:"name"`
+	}
+
+	t.Setenv("DIRS", "/a:/b,c:/d")
+	t.Setenv("NUMS", "1:2:3")
+	t.Setenv("NAME", "x:y")
+
+	b := flagstruct.NewBuilder()
+	b.Name = "-"
+	b.HandlingMode = pflag.ContinueOnError
+	b.EnvListSeparator = ":"
+
+	options := &Options{Dirs: []string{"/default"}}
+	fs := b.Build(options)
+	if err := fs.Parse(nil); err != nil {
+		t.Fatalf("unexpected error: %+v", err)
+	}
+
+	want := `{"Dirs":["/a","/b","c","/d"],"Nums":[1,2,3],"Name":"x:y"}`
+	if b, _ := json.Marshal(options); want != string(b) {
+		t.Errorf("want %s, but got %s", want, string(b))
+	}
+}
+
+func TestFlagSet_Parse_FromFile(t *testing.T) {
+	type Options struct {
+		Token string `flag:"token" fromfile:"true"`
+		Name  string `flag:"name"`
+	}
+
+	filename := filepath.Join(t.TempDir(), "token.txt")
+	if err := os.WriteFile(filename, []byte("s3cret\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		msg  string
+		args []string
+		want string
+	}{
+		{msg: "literal", args: []string{"--token", "literal", "--name", "@foo"}, want: `{"Token":"literal","Name":"@foo"}`},
+		{msg: "@file", args: []string{"--token", "@" + filename}, want: `{"Token":"s3cret","Name":""}`},
+		{msg: "file://", args: []string{"--token", "file://" + filename}, want: `{"Token":"s3cret","Name":""}`},
+	}
+
+	for _, c := range cases {
+		c := c
+		t.Run(c.msg, func(t *testing.T) {
+			b := flagstruct.NewBuilder()
+			b.Name = "-"
+			b.EnvvarSupport = false
+			b.HandlingMode = pflag.ContinueOnError
+
+			options := &Options{}
+			fs := b.Build(options)
+			if err := fs.Parse(c.args); err != nil {
+				t.Fatalf("unexpected error: %+v", err)
+			}
+			if b, _ := json.Marshal(options); c.want != string(b) {
+				t.Errorf("want %s, but got %s", c.want, string(b))
+			}
+		})
+	}
+
+	t.Run("missing file", func(t *testing.T) {
+		b := flagstruct.NewBuilder()
+		b.Name = "-"
+		b.EnvvarSupport = false
+		b.HandlingMode = pflag.ContinueOnError
+
+		fs := b.Build(&Options{})
+		fs.SetOutput(io.Discard)
+		if err := fs.Parse([]string{"--token", "@" + filename + ".missing"}); err == nil {
+			t.Errorf("must be error, but nil")
+		}
+	})
+}
+
+func TestBuilder_Build_HelpTemplates(t *testing.T) {
+	type Options struct {
+		Timeout time.Duration `flag:"timeout" help:"timeout (default {{.Default}}, env {{.Env}})"`
+		Name    string        `flag:"name" help:"name of {{.Type}}"`
+	}
+
+	b := flagstruct.NewBuilder()
+	b.Name = "-"
+	b.EnvHelpFormat = ""
+	b.EnvPrefix = "X_"
+	b.HelpTemplates = true
+
+	fs := b.Build(&Options{Timeout: 5 * time.Second})
+	if want, got := "timeout (default 5s, env X_TIMEOUT)", fs.Lookup("timeout").Usage; want != got {
+		t.Errorf("want %q, but got %q", want, got)
+	}
+	if want, got := "name of string", fs.Lookup("name").Usage; want != got {
+		t.Errorf("want %q, but got %q", want, got)
+	}
+}
+
+func TestBuilder_BuildDynamic(t *testing.T) {
+	b := flagstruct.NewBuilder()
+	b.Name = "-"
+	b.EnvPrefix = "X_"
+	b.HandlingMode = pflag.ContinueOnError
+
+	t.Setenv("X_RETRY", "5")
+
+	schema := []flagstruct.FieldSpec{
+		{Name: "name", Default: "foo", Help: "name of plugin"},
+		{Name: "verbose", Type: reflect.TypeOf(false), Shorthand: "v"},
+		{Name: "retry", Default: 3},
+		{Name: "timeout", Default: time.Second},
+		{Name: "tags", Type: reflect.TypeOf([]string{})},
+	}
+	fs, values := b.BuildDynamic(schema)
+	if want, got := "foo", values["name"]; want != got {
+		t.Errorf("default: want %v, but got %v", want, got)
+	}
+
+	if err := fs.Parse([]string{"-v", "--timeout", "2s", "--tags", "x,y"}); err != nil {
+		t.Fatalf("unexpected error: %+v", err)
+	}
+
+	want := map[string]interface{}{
+		"name":    "foo",
+		"verbose": true,
+		"retry":   5,
+		"timeout": 2 * time.Second,
+		"tags":    []string{"x", "y"},
+	}
+	if !reflect.DeepEqual(want, values) {
+		t.Errorf("want %v, but got %v", want, values)
+	}
+}
+
+func TestBuilder_BuildDynamic_WithConfig(t *testing.T) {
+	b := flagstruct.NewBuilder()
+	b.Name = "my-plugin"
+	b.EnvPrefix = ""
+	b.DeriveEnvPrefixFromName = true
+	b.CaseInsensitive = true
+	b.Version = "v0.1.0"
+	b.HandlingMode = pflag.ContinueOnError
+
+	t.Setenv("MY_PLUGIN_RETRY", "5")
+
+	schema := []flagstruct.FieldSpec{
+		{Name: "name", Default: "foo"},
+		{Name: "retry", Default: 3},
+	}
+	fs, values := b.BuildDynamic(schema)
+	if fs.Lookup("version") == nil {
+		t.Errorf("--version must be defined")
+	}
+
+	if err := fs.Parse([]string{"--NAME", "bar"}); err != nil {
+		t.Fatalf("unexpected error: %+v", err)
+	}
+	want := map[string]interface{}{"name": "bar", "retry": 5}
+	if !reflect.DeepEqual(want, values) {
+		t.Errorf("want %v, but got %v", want, values)
+	}
+}
+
+func TestFlagSet_Parse_ShortOnly(t *testing.T) {
+	type Options struct {
+		Verbose bool   `short:"v" shortonly:"true"`
+		Name    string `flag:"name"`
+	}
+
+	cases := []struct {
+		msg     string
+		args    []string
+		wantErr bool
+	}{
+		{msg: "shorthand", args: []string{"-v", "--name", "foo"}},
+		{msg: "long name", args: []string{"--Verbose"}, wantErr: true},
+		{msg: "long name with value", args: []string{"--Verbose=true"}, wantErr: true},
+		{msg: "after --", args: []string{"-v", "--", "--Verbose"}},
+	}
+
+	for _, c := range cases {
+		c := c
+		t.Run(c.msg, func(t *testing.T) {
+			b := flagstruct.NewBuilder()
+			b.Name = "-"
+			b.EnvvarSupport = false
+			b.HandlingMode = pflag.ContinueOnError
+
+			options := &Options{}
+			fs := b.Build(options)
+			err := fs.Parse(c.args)
+			if c.wantErr {
+				if err == nil {
+					t.Fatalf("must be error, but nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %+v", err)
+			}
+			if !options.Verbose {
+				t.Errorf("-v must be set")
+			}
+		})
+	}
+}
+
+func TestFlagSet_Parse_NegativeDuration(t *testing.T) {
+	type Options struct {
+		Skew  time.Duration   `flag:"skew"`
+		Skews []time.Duration `flag:"skews"`
+	}
+
+	cases := []struct {
+		msg  string
+		args []string
+		envs map[string]string
+	}{
+		{msg: "command-line", args: []string{"--skew", "-5s", "--skews", "-1s,2s", "--skews", "-3m"}},
+		{msg: "envvar", envs: map[string]string{"SKEW": "-5s", "SKEWS": "-1s,2s,-3m"}},
+	}
+
+	want := Options{Skew: -5 * time.Second, Skews: []time.Duration{-time.Second, 2 * time.Second, -3 * time.Minute}}
+	for _, c := range cases {
+		c := c
+		t.Run(c.msg, func(t *testing.T) {
+			for k, v := range c.envs {
+				t.Setenv(k, v)
+			}
+
+			b := flagstruct.NewBuilder()
+			b.Name = "-"
+			b.EnvvarSupport = len(c.envs) > 0
+			b.HandlingMode = pflag.ContinueOnError
+
+			options := &Options{Skews: []time.Duration{-time.Hour}}
+			fs := b.Build(options)
+			if want, got := "[-1h0m0s]", fs.Lookup("skews").DefValue; want != got {
+				t.Errorf("default: want %q, but got %q", want, got)
+			}
+			if err := fs.Parse(c.args); err != nil {
+				t.Fatalf("unexpected error: %+v", err)
+			}
+			if !reflect.DeepEqual(want, *options) {
+				t.Errorf("want %v, but got %v", want, *options)
+			}
+		})
+	}
+}
+
+func TestBuilder_MustBuild(t *testing.T) {
+	type Options struct {
+		Verbose bool `flag:"verbose" short:"v"`
+		Version bool `flag:"version" short:"v"`
+	}
+
+	b := flagstruct.NewBuilder()
+	b.Name = "-"
+	b.EnvvarSupport = false
+
+	defer func() {
+		r := recover()
+		if r == nil {
+			t.Fatalf("must be panic, but not")
+		}
+		err, ok := r.(error)
+		if !ok {
+			t.Fatalf("panic value must be error, but got %T", r)
+		}
+		if msg := err.Error(); !strings.Contains(msg, `shorthand "v"`) {
+			t.Errorf("unexpected panic message: %q", msg)
+		}
+	}()
+	b.MustBuild(&Options{})
+}
+
+func TestFlagSet_Parse_Aliases(t *testing.T) {
+	type Options struct {
+		Timeout time.Duration `flag:"timeout" aliases:"deadline,ttl" required:"true"`
+		Verbose bool          `flag:"verbose" aliases:"debug"`
+	}
+
+	cases := []struct {
+		msg  string
+		args []string
+	}{
+		{msg: "canonical", args: []string{"--timeout", "1s", "--verbose"}},
+		{msg: "alias", args: []string{"--deadline", "1s", "--debug"}},
+		{msg: "another alias", args: []string{"--ttl=1s", "--debug"}},
+	}
+
+	for _, c := range cases {
+		c := c
+		t.Run(c.msg, func(t *testing.T) {
+			b := flagstruct.NewBuilder()
+			b.Name = "-"
+			b.EnvvarSupport = false
+			b.HandlingMode = pflag.ContinueOnError
+
+			options := &Options{}
+			fs := b.Build(options)
+			if err := fs.Parse(c.args); err != nil {
+				t.Fatalf("unexpected error: %+v", err)
+			}
+			if want, got := (Options{Timeout: time.Second, Verbose: true}), *options; want != got {
+				t.Errorf("want %v, but got %v", want, got)
+			}
+			if !fs.Changed("timeout") {
+				t.Errorf("--timeout must be changed")
+			}
+		})
+	}
+
+	t.Run("conflict", func(t *testing.T) {
+		type Options struct {
+			Timeout  time.Duration `flag:"timeout" aliases:"deadline"`
+			Deadline time.Duration `flag:"deadline"`
+		}
+
+		b := flagstruct.NewBuilder()
+		b.Name = "-"
+		b.EnvvarSupport = false
+		if _, err := b.BuildE(&Options{}); err == nil {
+			t.Errorf("must be error, but nil")
+		}
+	})
+
+	t.Run("with fromfile", func(t *testing.T) {
+		type Options struct {
+			Token string `flag:"token" aliases:"tok" fromfile:"true"`
+		}
+
+		filename := filepath.Join(t.TempDir(), "token.txt")
+		if err := os.WriteFile(filename, []byte("s3cret\n"), 0600); err != nil {
+			t.Fatal(err)
+		}
+
+		b := flagstruct.NewBuilder()
+		b.Name = "-"
+		b.EnvvarSupport = false
+		b.HandlingMode = pflag.ContinueOnError
+
+		options := &Options{}
+		fs := b.Build(options)
+		if err := fs.Parse([]string{"--tok", "@" + filename}); err != nil {
+			t.Fatalf("unexpected error: %+v", err)
+		}
+		if want, got := "s3cret", options.Token; want != got {
+			t.Errorf("want %q, but got %q", want, got)
+		}
+	})
+}
+
+func TestFlagSet_ParseEnvOnly(t *testing.T) {
+	type Options struct {
+		Name     string   `flag:"name" required:"true"`
+		Port     int      `flag:"port"`
+		Tags     []string `flag:"tag"`
+		LogLevel LogLevel `flag:"log-level"`
+	}
+
+	newBuilder := func() *flagstruct.Builder {
+		b := flagstruct.NewBuilder()
+		b.Name = "-"
+		b.EnvPrefix = "X_"
+		b.HandlingMode = pflag.ContinueOnError
+		return b
+	}
+
+	t.Run("ok", func(t *testing.T) {
+		t.Setenv("X_NAME", "foo")
+		t.Setenv("X_PORT", "8080")
+		t.Setenv("X_TAG", "x,y")
+		t.Setenv("X_LOG_LEVEL", "debug")
+
+		options := &Options{LogLevel: LogLevelInfo}
+		fs := newBuilder().Build(options)
+		if err := fs.ParseEnvOnly(); err != nil {
+			t.Fatalf("unexpected error: %+v", err)
+		}
+
+		want := `{"Name":"foo","Port":8080,"Tags":["x","y"],"LogLevel":"DEBUG"}`
+		if b, _ := json.Marshal(options); want != string(b) {
+			t.Errorf("want %s, but got %s", want, string(b))
+		}
+	})
+
+	t.Run("required", func(t *testing.T) {
+		t.Setenv("X_PORT", "8080")
+
+		fs := newBuilder().Build(&Options{LogLevel: LogLevelInfo})
+		if err := fs.ParseEnvOnly(); err == nil {
+			t.Errorf("must be error, but nil")
+		}
+	})
+
+	t.Run("validation", func(t *testing.T) {
+		t.Setenv("X_NAME", "foo")
+
+		fs := newBuilder().Build(&Options{LogLevel: "bogus"})
+		if err := fs.ParseEnvOnly(); err == nil {
+			t.Errorf("must be error, but nil")
+		}
+	})
+}
+
+func TestFlagSet_Parse_StrictEnv(t *testing.T) {
+	type Options struct {
+		Timeout time.Duration `flag:"timeout"`
+		Name    string        `flag:"name"`
+	}
+
+	newBuilder := func(strict bool) *flagstruct.Builder {
+		b := flagstruct.NewBuilder()
+		b.Name = "-"
+		b.EnvPrefix = "STRICTAPP_"
+		b.StrictEnv = strict
+		b.HandlingMode = pflag.ContinueOnError
+		return b
+	}
+
+	t.Setenv("STRICTAPP_TIMEOUT", "1s")
+	t.Setenv("STRICTAPP_TIMOUT", "2s")
+	t.Setenv("STRICTAPP_NAMEE", "foo")
+
+	t.Run("strict", func(t *testing.T) {
+		fs := newBuilder(true).Build(&Options{})
+		err := fs.Parse(nil)
+		if err == nil {
+			t.Fatalf("must be error, but nil")
+		}
+		if want, got := `unknown envvar(s) with prefix "STRICTAPP_": STRICTAPP_NAMEE, STRICTAPP_TIMOUT`, err.Error(); want != got {
+			t.Errorf("want %q, but got %q", want, got)
+		}
+	})
+
+	t.Run("not strict", func(t *testing.T) {
+		options := &Options{}
+		fs := newBuilder(false).Build(options)
+		if err := fs.Parse(nil); err != nil {
+			t.Fatalf("unexpected error: %+v", err)
+		}
+		if want, got := time.Second, options.Timeout; want != got {
+			t.Errorf("want %v, but got %v", want, got)
+		}
+	})
+}
+
+func TestFlagSet_Parse_SecretRef(t *testing.T) {
+	type Options struct {
+		Password string `flag:"password" secretref:"vault:secret/db#password"`
+		APIKey   string `flag:"api-key" secretref:"vault:secret/api#key"`
+		Name     string `flag:"name"`
+	}
+
+	secrets := map[string]string{
+		"vault:secret/db#password": "s3cret",
+		"vault:secret/api#key":     "xxx",
+	}
+	var resolved []string
+	resolver := func(ref string) (string, error) {
+		resolved = append(resolved, ref)
+		v, ok := secrets[ref]
+		if !ok {
+			return "", fmt.Errorf("not found")
+		}
+		return v, nil
+	}
+
+	b := flagstruct.NewBuilder()
+	b.Name = "-"
+	b.EnvvarSupport = false
+	b.HandlingMode = pflag.ContinueOnError
+	b.SecretResolver = resolver
+
+	options := &Options{}
+	fs := b.Build(options)
+	if err := fs.Parse([]string{"--api-key", "from-cli"}); err != nil {
+		t.Fatalf("unexpected error: %+v", err)
+	}
+
+	want := `{"Password":"s3cret","APIKey":"from-cli","Name":""}`
+	if b, _ := json.Marshal(options); want != string(b) {
+		t.Errorf("want %s, but got %s", want, string(b))
+	}
+	if want, got := []string{"vault:secret/db#password"}, resolved; !reflect.DeepEqual(want, got) {
+		t.Errorf("resolved: want %v, but got %v", want, got)
+	}
+
+	t.Run("without resolver", func(t *testing.T) {
+		b := flagstruct.NewBuilder()
+		b.Name = "-"
+		b.EnvvarSupport = false
+		b.HandlingMode = pflag.ContinueOnError
+
+		fs := b.Build(&Options{})
+		if err := fs.Parse(nil); err == nil {
+			t.Errorf("must be error, but nil")
+		}
+	})
+
+	t.Run("without resolver, all set", func(t *testing.T) {
+		b := flagstruct.NewBuilder()
+		b.Name = "-"
+		b.EnvvarSupport = false
+		b.HandlingMode = pflag.ContinueOnError
+
+		options := &Options{}
+		fs := b.Build(options)
+		if err := fs.Parse([]string{"--password", "p", "--api-key", "k"}); err != nil {
+			t.Fatalf("unexpected error: %+v", err)
+		}
+		want := `{"Password":"p","APIKey":"k","Name":""}`
+		if b, _ := json.Marshal(options); want != string(b) {
+			t.Errorf("want %s, but got %s", want, string(b))
+		}
+	})
+}
+
+func TestFlagSet_Parse_Choices(t *testing.T) {
+	type Options struct {
+		BlockSize int `flag:"block-size" choices:"1,2,4,8"`
+	}
+
+	cases := []struct {
+		msg     string
+		args    []string
+		want    int
+		wantErr string
+	}{
+		{msg: "default", args: nil, want: 4},
+		{msg: "valid", args: []string{"--block-size", "8"}, want: 8},
+		{msg: "invalid", args: []string{"--block-size", "3"}, wantErr: "must be one of 1, 2, 4, 8"},
+		{msg: "not integer", args: []string{"--block-size", "x"}, wantErr: "invalid syntax"},
+	}
+
+	for _, c := range cases {
+		c := c
+		t.Run(c.msg, func(t *testing.T) {
+			b := flagstruct.NewBuilder()
+			b.Name = "-"
+			b.EnvvarSupport = false
+			b.HandlingMode = pflag.ContinueOnError
+
+			options := &Options{BlockSize: 4}
+			fs := b.Build(options)
+			fs.SetOutput(io.Discard)
+			if want, got := "- (allowed: 1, 2, 4, 8)", fs.Lookup("block-size").Usage; want != got {
+				t.Errorf("usage: want %q, but got %q", want, got)
+			}
+
+			err := fs.Parse(c.args)
+			if c.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), c.wantErr) {
+					t.Fatalf("error must include %q, but got %+v", c.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %+v", err)
+			}
+			if want, got := c.want, options.BlockSize; want != got {
+				t.Errorf("want %v, but got %v", want, got)
+			}
+		})
+	}
+}
+
+func TestFlagSet_Parse_MinMax(t *testing.T) {
+	type Options struct {
+		Port    int     `flag:"port" min:"1" max:"65535"`
+		Offset  int64   `flag:"offset" min:"-10" max:"10"`
+		Workers uint    `flag:"workers" min:"1"`
+		Size    uint64  `flag:"size" max:"1024"`
+		Ratio   float64 `flag:"ratio" min:"0" max:"1"`
+	}
+
+	cases := []struct {
+		msg     string
+		args    []string
+		wantErr string
+	}{
+		{msg: "valid", args: []string{"--port", "65535", "--offset", "-10", "--workers", "4", "--size", "1024", "--ratio", "0.5"}},
+		{msg: "port below min", args: []string{"--port", "0"}, wantErr: "must be between 1 and 65535"},
+		{msg: "port above max", args: []string{"--port", "65536"}, wantErr: "must be between 1 and 65535"},
+		{msg: "int64 below min", args: []string{"--offset", "-11"}, wantErr: "must be between -10 and 10"},
+		{msg: "uint below min", args: []string{"--workers", "0"}, wantErr: "must be greater than or equal to 1"},
+		{msg: "uint64 above max", args: []string{"--size", "1025"}, wantErr: "must be less than or equal to 1024"},
+		{msg: "float64 above max", args: []string{"--ratio", "1.5"}, wantErr: "must be between 0 and 1"},
+	}
+
+	for _, c := range cases {
+		c := c
+		t.Run(c.msg, func(t *testing.T) {
+			b := flagstruct.NewBuilder()
+			b.Name = "-"
+			b.EnvvarSupport = false
+			b.HandlingMode = pflag.ContinueOnError
+
+			fs := b.Build(&Options{Port: 8080, Workers: 1})
+			fs.SetOutput(io.Discard)
+
+			err := fs.Parse(c.args)
+			if c.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), c.wantErr) {
+					t.Fatalf("error must include %q, but got %+v", c.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %+v", err)
+			}
+		})
+	}
+}
+
+func TestFlagSet_Parse_Pattern(t *testing.T) {
+	type Options struct {
+		Name string `flag:"name" pattern:"^[a-z0-9-]+$"`
+	}
+
+	cases := []struct {
+		msg     string
+		args    []string
+		wantErr string
+	}{
+		{msg: "match", args: []string{"--name", "my-app-1"}},
+		{msg: "not match", args: []string{"--name", "My_App"}, wantErr: `must match the pattern "^[a-z0-9-]+$"`},
+	}
+
+	for _, c := range cases {
+		c := c
+		t.Run(c.msg, func(t *testing.T) {
+			b := flagstruct.NewBuilder()
+			b.Name = "-"
+			b.EnvvarSupport = false
+			b.HandlingMode = pflag.ContinueOnError
+
+			options := &Options{}
+			fs := b.Build(options)
+			fs.SetOutput(io.Discard)
+
+			err := fs.Parse(c.args)
+			if c.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), c.wantErr) {
+					t.Fatalf("error must include %q, but got %+v", c.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %+v", err)
+			}
+			if want, got := "my-app-1", options.Name; want != got {
+				t.Errorf("want %q, but got %q", want, got)
+			}
+		})
+	}
+
+	t.Run("invalid pattern", func(t *testing.T) {
+		type Options struct {
+			Name string `flag:"name" pattern:"[a-z"`
+		}
+
+		b := flagstruct.NewBuilder()
+		b.Name = "-"
+		b.EnvvarSupport = false
+		if _, err := b.BuildE(&Options{}); err == nil {
+			t.Errorf("must be error, but nil")
+		}
+	})
+}
+
+func TestFlagSet_Parse_Case(t *testing.T) {
+	type Options struct {
+		Name   string `flag:"name" case:"lower" pattern:"^[a-z]+$"`
+		Region string `flag:"region" case:"upper"`
+	}
+
+	b := flagstruct.NewBuilder()
+	b.Name = "-"
+	b.EnvvarSupport = false
+	b.HandlingMode = pflag.ContinueOnError
+
+	options := &Options{}
+	fs := b.Build(options)
+	if err := fs.Parse([]string{"--name", "FOO", "--region", "us"}); err != nil {
+		t.Fatalf("unexpected error: %+v", err)
+	}
+	if want, got := (Options{Name: "foo", Region: "US"}), *options; want != got {
+		t.Errorf("want %v, but got %v", want, got)
+	}
+}
+
+func TestFlagSet_PrintDefaultsMarkdown(t *testing.T) {
+	type DB struct {
+		URI string `flag:"uri" help:"connection string"`
+	}
+	type Options struct {
+		Name    string `flag:"name" short:"n" help:"name of a|b" required:"true"`
+		Verbose bool   `flag:"verbose" env:"-"`
+		DB      DB     `flag:"db"`
+	}
+
+	b := flagstruct.NewBuilder()
+	b.Name = "-"
+
+	fs := b.Build(&Options{Name: "foo", DB: DB{URI: "sqlite://"}})
+	var buf strings.Builder
+	fs.PrintDefaultsMarkdown(&buf)
+
+	want := strings.Join([]string{
+		"| Flag | Shorthand | Env | Default | Description |",
+		"| --- | --- | --- | --- | --- |",
+		"| `--name` | `-n` | `NAME` | `foo` | name of a\\|b (required) |",
+		"| `--verbose` |  |  | `false` |  |",
+		"| `--db.uri` |  | `DB_URI` | `sqlite://` | connection string |",
+		"",
+	}, "\n")
+	if got := buf.String(); want != got {
+		t.Errorf("want\n%s\nbut got\n%s", want, got)
+	}
+}
+
+func TestBuilder_BuildE_InvalidTarget(t *testing.T) {
+	type Options struct {
+		Name string `flag:"name"`
+	}
+
+	n := 0
+	cases := []struct {
+		msg  string
+		o    interface{}
+		want string
+	}{
+		{msg: "not pointer", o: Options{}, want: "flagstruct_test.Options is not pointer of struct"},
+		{msg: "pointer of non-struct", o: &n, want: "*int is pointer of non-struct, but pointer of struct is required"},
+		{msg: "nil pointer", o: (*Options)(nil), want: "*flagstruct_test.Options is nil pointer, but pointer of struct is required"},
+		{msg: "nil", o: nil, want: "nil is passed, but pointer of struct is required"},
+	}
+
+	for _, c := range cases {
+		c := c
+		t.Run(c.msg, func(t *testing.T) {
+			b := flagstruct.NewBuilder()
+			b.Name = "-"
+			_, err := b.BuildE(c.o)
+			if err == nil {
+				t.Fatalf("must be error, but nil")
+			}
+			if want, got := c.want, err.Error(); want != got {
+				t.Errorf("want %q, but got %q", want, got)
+			}
+		})
+	}
+}
+
+type ID int
+
+type Level int
+
+func TestBuilder_Build_EmbeddedNonStruct(t *testing.T) {
+	type Options struct {
+		ID
+		*Level `flag:"level"`
+		Name   string `flag:"name"`
+	}
+
+	b := flagstruct.NewBuilder()
+	b.Name = "-"
+	b.EnvvarSupport = false
+	b.HandlingMode = pflag.ContinueOnError
+
+	options := &Options{}
+	fs := b.Build(options)
+	if err := fs.Parse([]string{"--ID", "10", "--level", "2", "--name", "foo"}); err != nil {
+		t.Fatalf("unexpected error: %+v", err)
+	}
+
+	want := `{"ID":10,"Level":2,"Name":"foo"}`
+	if b, _ := json.Marshal(options); want != string(b) {
+		t.Errorf("want %s, but got %s", want, string(b))
+	}
+
+	t.Run("untagged nil pointer", func(t *testing.T) {
+		type Options struct {
+			*Level
+			Name string `flag:"name"`
+		}
+
+		b := flagstruct.NewBuilder()
+		b.Name = "-"
+		b.EnvvarSupport = false
+		b.HandlingMode = pflag.ContinueOnError
+
+		options := &Options{}
+		fs := b.Build(options)
+		if err := fs.Parse([]string{"--name", "foo"}); err != nil {
+			t.Fatalf("unexpected error: %+v", err)
+		}
+		if options.Level != nil {
+			t.Errorf("must be nil, but got %v", *options.Level)
+		}
+	})
+}
+
+func TestFlagSet_MarshalConfig(t *testing.T) {
+	type DB struct {
+		URI      string `flag:"uri" json:"uri"`
+		Password string `flag:"password" json:"password" sensitive:"true"`
+	}
+	type Options struct {
+		Name  string `flag:"name" json:"name"`
+		Token int    `flag:"token" json:"token" sensitive:"true"`
+		DB    *DB    `flag:"db" json:"db"`
+	}
+
+	b := flagstruct.NewBuilder()
+	b.Name = "-"
+	b.EnvvarSupport = false
+	b.HandlingMode = pflag.ContinueOnError
+
+	options := &Options{}
+	fs := b.Build(options)
+	if err := fs.Parse([]string{"--name", "foo", "--token", "1234", "--db.uri", "mysql://", "--db.password", "s3cret"}); err != nil {
+		t.Fatalf("unexpected error: %+v", err)
+	}
+
+	got, err := fs.MarshalConfig()
+	if err != nil {
+		t.Fatalf("unexpected error: %+v", err)
+	}
+	want := `{"name":"foo","token":0,"db":{"uri":"mysql://","password":"****"}}`
+	if want != string(got) {
+		t.Errorf("want %s, but got %s", want, string(got))
+	}
+	if want, got := "s3cret", options.DB.Password; want != got {
+		t.Errorf("the original value must not be modified, want %q, but got %q", want, got)
+	}
+}
+
+func TestBuilder_Build_StripFieldPrefix(t *testing.T) {
+	type Options struct {
+		ServerHost string
+		ServerPort int
+		ServerName string `flag:"server-name"`
+		Server     bool
+		Verbose    bool
+	}
+
+	b := flagstruct.NewBuilder()
+	b.Name = "-"
+	b.EnvvarSupport = false
+	b.StripFieldPrefix = "Server"
+	b.FlagNameFunc = strings.ToLower
+
+	fs := b.Build(&Options{})
+	var got []string
+	fs.VisitAll(func(f *pflag.Flag) {
+		got = append(got, f.Name)
+	})
+	if want := []string{"host", "port", "server", "server-name", "verbose"}; !reflect.DeepEqual(want, got) {
+		t.Errorf("want flags %v, but got %v", want, got)
+	}
+}
+
+func TestFlagSet_SetHandlingMode(t *testing.T) {
+	type Options struct {
+		Port int `flag:"port"`
+	}
+
+	b := flagstruct.NewBuilder()
+	b.Name = "-"
+	b.EnvvarSupport = false
+	b.HandlingMode = pflag.PanicOnError
+
+	options := &Options{}
+	fs := b.Build(options)
+	fs.SetOutput(io.Discard)
+	fs.SetHandlingMode(pflag.ContinueOnError)
+
+	if err := fs.Parse([]string{"--port", "x"}); err == nil {
+		t.Errorf("must be error, but nil")
+	}
+	if want, got := pflag.PanicOnError, b.HandlingMode; want != got {
+		t.Errorf("the builder's config must not be modified, want %v, but got %v", want, got)
+	}
+
+	fs.SetHandlingMode(pflag.PanicOnError)
+	func() {
+		defer func() {
+			if r := recover(); r == nil {
+				t.Errorf("must be panic, but not")
+			}
+		}()
+		fs.Parse([]string{"--port", "x"})
+	}()
+
+	t.Run("build-into", func(t *testing.T) {
+		b := flagstruct.NewBuilder()
+		b.Name = "-"
+		b.EnvvarSupport = false
+
+		outer := pflag.NewFlagSet("outer", pflag.PanicOnError)
+		fs := b.BuildInto(outer, &Options{})
+		fs.SetHandlingMode(pflag.ContinueOnError)
+
+		var buf strings.Builder
+		fs.SetOutput(&buf)
+		if err := fs.Parse([]string{"--help"}); !errors.Is(err, pflag.ErrHelp) {
+			t.Fatalf("must be ErrHelp, but got %+v", err)
+		}
+		if want, got := "Usage of outer:", buf.String(); !strings.HasPrefix(got, want) {
+			t.Errorf("the name must be kept, want %q, but got %q", want, got)
+		}
+	})
+}
+
+func TestFlagSet_Check(t *testing.T) {
+	type Options struct {
+		Name string   `flag:"name"`
+		Tags []string `flag:"tag"`
+	}
+
+	b := flagstruct.NewBuilder()
+	b.Name = "-"
+	b.EnvvarSupport = false
+	b.HandlingMode = pflag.ExitOnError
+	b.Version = "v0.0.0"
+
+	options := &Options{Name: "default", Tags: []string{"x"}}
+	fs := b.Build(options)
+
+	if err := fs.Check([]string{"--name", "foo", "--tag", "y", "--version"}); err != nil {
+		t.Errorf("unexpected error: %+v", err)
+	}
+	if err := fs.Check([]string{"--name", "foo", "--unknown"}); err == nil || !strings.Contains(err.Error(), "unknown flag: --unknown") {
+		t.Errorf("must be unknown flag error, but got %+v", err)
+	}
+
+	want := `{"Name":"default","Tags":["x"]}`
+	if b, _ := json.Marshal(options); want != string(b) {
+		t.Errorf("the bound struct must not be modified, want %s, but got %s", want, string(b))
+	}
+	if fs.Changed("name") {
+		t.Errorf("--name must not be changed")
+	}
+}
+
+func TestBuilder_Build_FlagPrefix(t *testing.T) {
+	type Database struct {
+		Host string `flag:"host"`
+	}
+	type Cache struct {
+		TTL int `flag:"ttl"`
+	}
+	type Options struct {
+		DB    Database  `flag:"db" flagprefix:"database"`
+		Cache *Cache    `flag:"cache" flagprefix:""`
+		Other *Database `flag:"other"`
+	}
+
+	b := flagstruct.NewBuilder()
+	b.Name = "-"
+	b.EnvvarSupport = false
+	b.HandlingMode = pflag.ContinueOnError
+
+	options := &Options{}
+	fs := b.Build(options)
+
+	var got []string
+	fs.VisitAll(func(f *pflag.Flag) {
+		got = append(got, f.Name)
+	})
+	if want := []string{"database.host", "other.host", "ttl"}; !reflect.DeepEqual(want, got) {
+		t.Errorf("want flags %v, but got %v", want, got)
+	}
+
+	if err := fs.Parse([]string{"--database.host", "localhost", "--ttl", "10"}); err != nil {
+		t.Fatalf("unexpected error: %+v", err)
+	}
+	if want, got := "localhost", options.DB.Host; want != got {
+		t.Errorf("want %q, but got %q", want, got)
+	}
+	if want, got := 10, options.Cache.TTL; want != got {
+		t.Errorf("want %v, but got %v", want, got)
+	}
+}
+
+func TestBuilder_Build_FlexibleNumbers(t *testing.T) {
+	type Options struct {
+		Mask  uint  `flag:"mask"`
+		Count int   `flag:"count"`
+		Perm  int64 `flag:"perm"`
+		Bits  uint64
+	}
+
+	cases := []struct {
+		msg  string
+		args []string
+		want Options
+	}{
+		{msg: "decimal", args: []string{"--count", "10"}, want: Options{Count: 10}},
+		{msg: "underscore", args: []string{"--count", "1_000_000", "--Bits", "1_0"}, want: Options{Count: 1000000, Bits: 10}},
+		{msg: "hex", args: []string{"--mask", "0xFF"}, want: Options{Mask: 255}},
+		{msg: "octal-and-binary", args: []string{"--perm", "0o755", "--Bits", "0b1010"}, want: Options{Perm: 0o755, Bits: 10}},
+		{msg: "negative-hex", args: []string{"--count", "-0x10"}, want: Options{Count: -16}},
+	}
+
+	for _, c := range cases {
+		c := c
+		t.Run(c.msg, func(t *testing.T) {
+			b := flagstruct.NewBuilder()
+			b.Name = "-"
+			b.EnvvarSupport = false
+			b.HandlingMode = pflag.ContinueOnError
+			b.FlexibleNumbers = true
+
+			options := &Options{}
+			fs := b.Build(options)
+			if err := fs.Parse(c.args); err != nil {
+				t.Fatalf("unexpected error: %+v", err)
+			}
+			if want, got := c.want, *options; !reflect.DeepEqual(want, got) {
+				t.Errorf("want %+v, but got %+v", want, got)
+			}
+		})
+	}
+
+	t.Run("invalid", func(t *testing.T) {
+		b := flagstruct.NewBuilder()
+		b.Name = "-"
+		b.EnvvarSupport = false
+		b.HandlingMode = pflag.ContinueOnError
+		b.FlexibleNumbers = true
+
+		fs := b.Build(&Options{})
+		fs.SetOutput(io.Discard)
+		if err := fs.Parse([]string{"--mask", "-1"}); err == nil {
+			t.Errorf("want error for negative uint, but nil")
+		}
+	})
+}
+
+func TestBuilder_Build_Address(t *testing.T) {
+	type Options struct {
+		Listen *net.TCPAddr `flag:"listen"`
+		DNS    *net.UDPAddr `flag:"dns"`
+	}
+
+	cases := []struct {
+		msg     string
+		args    []string
+		listen  string
+		dns     string
+		wantErr bool
+	}{
+		{msg: "ipv4", args: []string{"--listen", "127.0.0.1:8080"}, listen: "127.0.0.1:8080"},
+		{msg: "all-interfaces", args: []string{"--listen", ":8080"}, listen: ":8080"},
+		{msg: "ipv6-udp", args: []string{"--dns", "[::1]:53"}, listen: "0.0.0.0:80", dns: "[::1]:53"},
+		{msg: "default", args: []string{}, listen: "0.0.0.0:80"},
+		{msg: "port-out-of-range", args: []string{"--listen", "127.0.0.1:65536"}, wantErr: true},
+		{msg: "missing-port", args: []string{"--listen", "127.0.0.1"}, wantErr: true},
+	}
+
+	for _, c := range cases {
+		c := c
+		t.Run(c.msg, func(t *testing.T) {
+			b := flagstruct.NewBuilder()
+			b.Name = "-"
+			b.EnvvarSupport = false
+			b.HandlingMode = pflag.ContinueOnError
+
+			options := &Options{Listen: &net.TCPAddr{IP: net.IPv4zero, Port: 80}}
+			fs := b.Build(options)
+			fs.SetOutput(io.Discard)
+
+			err := fs.Parse(c.args)
+			if c.wantErr {
+				if err == nil {
+					t.Errorf("want error, but nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %+v", err)
+			}
+			if want, got := c.listen, fs.Lookup("listen").Value.String(); want != got {
+				t.Errorf("want listen=%q, but got %q", want, got)
+			}
+			if want, got := c.dns, fs.Lookup("dns").Value.String(); want != got {
+				t.Errorf("want dns=%q, but got %q", want, got)
+			}
+		})
+	}
+}
+
+func TestBuilder_Build_Stdin(t *testing.T) {
+	type Options struct {
+		Body  string `flag:"body" stdin:"true"`
+		Extra string `flag:"extra" stdin:"true"`
+		Name  string `flag:"name"`
+	}
+
+	cases := []struct {
+		msg     string
+		args    []string
+		want    string
+		wantErr string
+	}{
+		{msg: "stdin", args: []string{"--body", "-"}, want: `{"Body":"hello\nworld","Extra":"","Name":""}`},
+		{msg: "not-stdin", args: []string{"--body", "direct"}, want: `{"Body":"direct","Extra":"","Name":""}`},
+		{msg: "without-tag", args: []string{"--name", "-"}, want: `{"Body":"","Extra":"","Name":"-"}`},
+		{msg: "twice", args: []string{"--body", "-", "--extra", "-"}, wantErr: "stdin is already consumed by --body"},
+	}
+
+	for _, c := range cases {
+		c := c
+		t.Run(c.msg, func(t *testing.T) {
+			b := flagstruct.NewBuilder()
+			b.Name = "-"
+			b.EnvvarSupport = false
+			b.HandlingMode = pflag.ContinueOnError
+			b.Stdin = strings.NewReader("hello\nworld\n")
+
+			options := &Options{}
+			fs := b.Build(options)
+			fs.SetOutput(io.Discard)
+
+			err := fs.Parse(c.args)
+			if c.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), c.wantErr) {
+					t.Errorf("want error %q, but got %+v", c.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %+v", err)
+			}
+			if b, _ := json.Marshal(options); c.want != string(b) {
+				t.Errorf("want %s, but got %s", c.want, string(b))
+			}
+		})
+	}
+
+	t.Run("parse-twice", func(t *testing.T) {
+		b := flagstruct.NewBuilder()
+		b.Name = "-"
+		b.EnvvarSupport = false
+		b.HandlingMode = pflag.ContinueOnError
+		b.Stdin = strings.NewReader("hello\n")
+
+		options := &Options{}
+		fs := b.Build(options)
+		if err := fs.Check([]string{"--body", "-"}); err != nil {
+			t.Fatalf("unexpected error on check: %+v", err)
+		}
+		if err := fs.Parse([]string{"--body", "-"}); err != nil {
+			t.Fatalf("unexpected error: %+v", err)
+		}
+		if err := fs.Parse([]string{"--extra", "-"}); err != nil {
+			t.Fatalf("unexpected error on the second parse: %+v", err)
+		}
+		want := `{"Body":"hello","Extra":"","Name":""}`
+		if b, _ := json.Marshal(options); want != string(b) {
+			t.Errorf("want %s, but got %s", want, string(b))
+		}
+	})
+}
+
+func TestBuilder_Build_PrefixAnonymous(t *testing.T) {
+	type Base struct {
+		Verbose bool `flag:"verbose"`
+	}
+	type Options struct {
+		Base
+		Name string `flag:"name"`
+	}
+
+	cases := []struct {
+		msg             string
+		prefixAnonymous bool
+		args            []string
+		want            []string
+	}{
+		{msg: "flatten", prefixAnonymous: false, args: []string{"--verbose"}, want: []string{"name", "verbose"}},
+		{msg: "prefixed", prefixAnonymous: true, args: []string{"--Base.verbose"}, want: []string{"Base.verbose", "name"}},
+	}
+
+	for _, c := range cases {
+		c := c
+		t.Run(c.msg, func(t *testing.T) {
+			b := flagstruct.NewBuilder()
+			b.Name = "-"
+			b.EnvvarSupport = false
+			b.HandlingMode = pflag.ContinueOnError
+			b.PrefixAnonymous = c.prefixAnonymous
+
+			options := &Options{}
+			fs := b.Build(options)
+
+			var got []string
+			fs.VisitAll(func(f *pflag.Flag) {
+				got = append(got, f.Name)
+			})
+			if !reflect.DeepEqual(c.want, got) {
+				t.Errorf("want flags %v, but got %v", c.want, got)
+			}
+
+			if err := fs.Parse(c.args); err != nil {
+				t.Fatalf("unexpected error: %+v", err)
+			}
+			if !options.Verbose {
+				t.Errorf("want verbose=true, but false")
+			}
+		})
+	}
+}
+
+func TestBuilder_Build_InlineKV(t *testing.T) {
+	type Opts struct {
+		Timeout time.Duration `flag:"timeout"`
+		Retries int           `flag:"retries"`
+		Mode    string
+	}
+	type Options struct {
+		Opts Opts  `flag:"opts" inline:"kv"`
+		Ptr  *Opts `flag:"ptr" inline:"kv"`
+	}
+
+	cases := []struct {
+		msg     string
+		args    []string
+		want    string
+		wantErr string
+	}{
+		{msg: "default", args: []string{}, want: `{"Opts":{"Timeout":1000000000,"Retries":0,"Mode":""},"Ptr":{"Timeout":0,"Retries":0,"Mode":""}}`},
+		{msg: "kv", args: []string{"--opts", "timeout=5s,retries=3,mode=fast"}, want: `{"Opts":{"Timeout":5000000000,"Retries":3,"Mode":"fast"},"Ptr":{"Timeout":0,"Retries":0,"Mode":""}}`},
+		{msg: "pointer", args: []string{"--ptr", "retries=2", "--ptr", "Mode=slow"}, want: `{"Opts":{"Timeout":1000000000,"Retries":0,"Mode":""},"Ptr":{"Timeout":0,"Retries":2,"Mode":"slow"}}`},
+		{msg: "unknown-key", args: []string{"--opts", "foo=bar"}, wantErr: `unknown key "foo"`},
+		{msg: "invalid-value", args: []string{"--opts", "retries=x"}, wantErr: "on key retries"},
+	}
+
+	for _, c := range cases {
+		c := c
+		t.Run(c.msg, func(t *testing.T) {
+			b := flagstruct.NewBuilder()
+			b.Name = "-"
+			b.EnvvarSupport = false
+			b.HandlingMode = pflag.ContinueOnError
+
+			options := &Options{Opts: Opts{Timeout: time.Second}}
+			fs := b.Build(options)
+			fs.SetOutput(io.Discard)
+
+			err := fs.Parse(c.args)
+			if c.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), c.wantErr) {
+					t.Errorf("want error %q, but got %+v", c.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %+v", err)
+			}
+			if b, _ := json.Marshal(options); c.want != string(b) {
+				t.Errorf("want %s, but got %s", c.want, string(b))
+			}
+		})
+	}
+}
+
+func TestBuilder_BuildInto(t *testing.T) {
+	type Options struct {
+		Name    string `flag:"name"`
+		Verbose bool   `flag:"verbose" short:"v"`
+	}
+
+	pfs := pflag.NewFlagSet("app", pflag.ContinueOnError)
+	debug := pfs.Bool("debug", false, "debug mode")
+
+	b := flagstruct.NewBuilder()
+	b.Name = "-"
+	b.EnvvarSupport = false
+	b.HandlingMode = pflag.ContinueOnError
+
+	options := &Options{Name: "foo"}
+	fs := b.BuildInto(pfs, options)
+	if fs.FlagSet != pfs {
+		t.Fatalf("the flags must be added to the existing FlagSet")
+	}
+
+	var got []string
+	pfs.VisitAll(func(f *pflag.Flag) {
+		got = append(got, f.Name)
+	})
+	if want := []string{"debug", "name", "verbose"}; !reflect.DeepEqual(want, got) {
+		t.Errorf("want flags %v, but got %v", want, got)
+	}
+
+	if err := fs.Parse([]string{"--debug", "--name", "bar", "-v"}); err != nil {
+		t.Fatalf("unexpected error: %+v", err)
+	}
+	if !*debug {
+		t.Errorf("want debug=true, but false")
+	}
+	want := `{"Name":"bar","Verbose":true}`
+	if b, _ := json.Marshal(options); want != string(b) {
+		t.Errorf("want %s, but got %s", want, string(b))
+	}
+}
+
+func TestFlagSet_WriteEnvTemplate(t *testing.T) {
+	type Options struct {
+		Name    string        `flag:"name" help:"name of the user" required:"true"`
+		Token   string        `flag:"token" help:"API token" sensitive:"true"`
+		Timeout time.Duration `flag:"timeout" help:"timeout of the request"`
+		Tags    []string      `flag:"tag" help:"tags"`
+		Message string        `flag:"message"`
+		Debug   bool          `flag:"debug" env:"-"`
+	}
+
+	b := flagstruct.NewBuilder()
+	b.Name = "-"
+	b.EnvPrefix = "X_"
+	b.HandlingMode = pflag.ContinueOnError
+
+	options := &Options{Name: "foo", Token: "s3cret", Timeout: 5 * time.Second, Tags: []string{"a", "b"}, Message: "hello world"}
+	fs := b.Build(options)
+
+	var buf strings.Builder
+	if err := fs.WriteEnvTemplate(&buf); err != nil {
+		t.Fatalf("unexpected error: %+v", err)
+	}
+
+	want := `# name of the user (required)
+X_NAME=foo
+
+# API token
+X_TOKEN=
+
+# timeout of the request
+X_TIMEOUT=5s
+
+# tags
+X_TAG=a,b
+
+X_MESSAGE="hello world"
+`
+	if got := buf.String(); want != got {
+		t.Errorf("want:\n%s\nbut got:\n%s", want, got)
+	}
+}
+
+func TestBuilder_Run(t *testing.T) {
+	type Options struct {
+		Name    string `flag:"name"`
+		Verbose bool   `flag:"verbose"`
+	}
+
+	cases := []struct {
+		msg     string
+		args    []string
+		want    string
+		wantErr error
+	}{
+		{msg: "ok", args: []string{"--name", "foo", "--verbose"}, want: `{"Name":"foo","Verbose":true}`},
+		{msg: "help", args: []string{"--help"}, wantErr: pflag.ErrHelp},
+		{msg: "version", args: []string{"--version"}, wantErr: flagstruct.ErrVersion},
+	}
+
+	for _, c := range cases {
+		c := c
+		t.Run(c.msg, func(t *testing.T) {
+			original := os.Args
+			os.Args = append([]string{"app"}, c.args...)
+			t.Cleanup(func() { os.Args = original })
+
+			b := flagstruct.NewBuilder()
+			b.Name = "-"
+			b.EnvvarSupport = false
+			b.Version = "v0.0.0"
+
+			options := &Options{}
+			stdout := os.Stdout
+			os.Stdout, _ = os.Open(os.DevNull) // for --version
+			err := b.Run(options)
+			os.Stdout = stdout
+
+			if c.wantErr != nil {
+				if !errors.Is(err, c.wantErr) {
+					t.Errorf("want error %v, but got %+v", c.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %+v", err)
+			}
+			if b, _ := json.Marshal(options); c.want != string(b) {
+				t.Errorf("want %s, but got %s", c.want, string(b))
+			}
+			if want, got := pflag.ExitOnError, b.HandlingMode; want != got {
+				t.Errorf("the builder must not be modified, want %v, but got %v", want, got)
+			}
+		})
+	}
+}
+
+func TestMultiError(t *testing.T) {
+	type Options struct {
+		Name     string    `flag:"name" required:"true"`
+		Token    string    `flag:"token" required:"true"`
+		LogLevel LogLevel  `flag:"log-level"`
+		Other    *LogLevel `flag:"other-log-level"`
+	}
+
+	newBuilder := func() *flagstruct.Builder {
+		b := flagstruct.NewBuilder()
+		b.Name = "-"
+		b.EnvvarSupport = false
+		b.HandlingMode = pflag.ContinueOnError
+		return b
+	}
+
+	t.Run("required", func(t *testing.T) {
+		other := LogLevelInfo
+		fs := newBuilder().Build(&Options{Other: &other})
+		err := fs.Parse(nil)
+
+		var merr *flagstruct.MultiError
+		if !errors.As(err, &merr) {
+			t.Fatalf("must be *MultiError, but got %#+v", err)
+		}
+		if want, got := 2, len(merr.Errors()); want != got {
+			t.Fatalf("want %d errors, but got %d (%+v)", want, got, err)
+		}
+		for i, want := range []string{`"name"`, `"token"`} {
+			if got := merr.Errors()[i].Error(); !strings.Contains(got, want) {
+				t.Errorf("errors[%d] must include %s, but got %q", i, want, got)
+			}
+		}
+	})
+
+	t.Run("validation", func(t *testing.T) {
+		other := LogLevel("bogus")
+		fs := newBuilder().Build(&Options{Name: "foo", Token: "xxx", LogLevel: "bogus", Other: &other})
+		err := fs.Validate()
+
+		var merr *flagstruct.MultiError
+		if !errors.As(err, &merr) {
+			t.Fatalf("must be *MultiError, but got %#+v", err)
+		}
+		if want, got := 2, len(merr.Errors()); want != got {
+			t.Fatalf("want %d errors, but got %d (%+v)", want, got, err)
+		}
+		for i, want := range []string{"on --log-level", "on --other-log-level"} {
+			if got := merr.Errors()[i].Error(); !strings.Contains(got, want) {
+				t.Errorf("errors[%d] must include %q, but got %q", i, want, got)
+			}
+		}
+	})
+}
+
+func TestBuilder_Build_EnvPrefixSeparator(t *testing.T) {
+	type Options struct {
+		Timeout time.Duration `flag:"timeout"`
+		DB      struct {
+			URI string `flag:"uri"`
+		} `flag:"db"`
+	}
+
+	cases := []struct {
+		msg    string
+		prefix string
+		want   []string
+	}{
+		{msg: "without-underscore", prefix: "APP", want: []string{"APP_TIMEOUT", "APP_DB_URI"}},
+		{msg: "with-underscore", prefix: "APP_", want: []string{"APP_TIMEOUT", "APP_DB_URI"}},
+		{msg: "with-underscores", prefix: "APP__", want: []string{"APP_TIMEOUT", "APP_DB_URI"}},
+		{msg: "empty", prefix: "", want: []string{"TIMEOUT", "DB_URI"}},
+	}
+
+	for _, c := range cases {
+		c := c
+		t.Run(c.msg, func(t *testing.T) {
+			b := flagstruct.NewBuilder()
+			b.Name = "-"
+			b.EnvPrefix = c.prefix
+			b.HandlingMode = pflag.ContinueOnError
+
+			options := &Options{}
+			fs := b.Build(options)
+			if got := fs.EnvVars(); !reflect.DeepEqual(c.want, got) {
+				t.Errorf("want %v, but got %v", c.want, got)
+			}
+
+			t.Setenv(c.want[0], "10s")
+			if err := fs.Parse(nil); err != nil {
+				t.Fatalf("unexpected error: %+v", err)
+			}
+			if want, got := 10*time.Second, options.Timeout; want != got {
+				t.Errorf("want %v, but got %v", want, got)
+			}
+		})
+	}
+}
+
+func TestBuilder_Build_DeriveEnvPrefixFromName(t *testing.T) {
+	type Options struct {
+		Timeout time.Duration `flag:"timeout"`
+	}
+
+	cases := []struct {
+		msg         string
+		name        string
+		prefix      string
+		envNameFunc func(string) string
+		want        []string
+	}{
+		{msg: "name", name: "myapp", want: []string{"MYAPP_TIMEOUT"}},
+		{msg: "path", name: "/usr/local/bin/my-app.exe", want: []string{"MY_APP_TIMEOUT"}},
+		{msg: "explicit-prefix", name: "myapp", prefix: "X_", want: []string{"X_TIMEOUT"}},
+		{msg: "empty-name", name: "-", want: []string{"TIMEOUT"}},
+		{msg: "custom-env-name-func", name: "app", envNameFunc: func(name string) string { return "APP_" + strings.ToUpper(name) }, want: []string{"APP_TIMEOUT"}},
+	}
+
+	for _, c := range cases {
+		c := c
+		t.Run(c.msg, func(t *testing.T) {
+			b := flagstruct.NewBuilder()
+			b.Name = c.name
+			b.EnvPrefix = c.prefix
+			b.HandlingMode = pflag.ContinueOnError
+			b.DeriveEnvPrefixFromName = true
+			if c.envNameFunc != nil {
+				b.EnvNameFunc = c.envNameFunc
+			}
+
+			options := &Options{}
+			fs := b.Build(options)
+			if got := fs.EnvVars(); !reflect.DeepEqual(c.want, got) {
+				t.Errorf("want %v, but got %v", c.want, got)
+			}
+
+			t.Setenv(c.want[0], "10s")
+			if err := fs.Parse(nil); err != nil {
+				t.Fatalf("unexpected error: %+v", err)
+			}
+			if want, got := 10*time.Second, options.Timeout; want != got {
+				t.Errorf("want %v, but got %v", want, got)
+			}
+		})
+	}
+}
+
+func TestBuilder_Build_DeriveEnvPrefixFromName_TwoBuilds(t *testing.T) {
+	type Options struct {
+		Timeout time.Duration `flag:"timeout"`
+	}
+
+	b := flagstruct.NewBuilder()
+	b.EnvPrefix = ""
+	b.HandlingMode = pflag.ContinueOnError
+	b.DeriveEnvPrefixFromName = true
+
+	alpha := b.BuildNamed("alpha", &Options{})
+	beta := b.BuildNamed("beta", &Options{})
+
+	if want, got := []string{"ALPHA_TIMEOUT"}, alpha.EnvVars(); !reflect.DeepEqual(want, got) {
+		t.Errorf("want %v, but got %v", want, got)
+	}
+	if want, got := []string{"BETA_TIMEOUT"}, beta.EnvVars(); !reflect.DeepEqual(want, got) {
+		t.Errorf("want %v, but got %v", want, got)
+	}
+	if b.EnvPrefix != "" {
+		t.Errorf("the Config of the builder must not be modified, but EnvPrefix=%q", b.EnvPrefix)
+	}
+}
+
+func TestBuilder_Build_MaxLen(t *testing.T) {
+	type Options struct {
+		Tags  []string `flag:"tag" maxlen:"3"`
+		Nums  []int    `flag:"num" maxlen:"2"`
+		Names []string `flag:"name"`
+	}
+
+	cases := []struct {
+		msg     string
+		args    []string
+		want    string
+		wantErr string
+	}{
+		{msg: "ok", args: []string{"--tag", "a", "--tag", "b", "--tag", "c", "--num", "1,2"}, want: `{"Tags":["a","b","c"],"Nums":[1,2],"Names":["x"]}`},
+		{msg: "default-is-overwritten", args: []string{"--name", "y"}, want: `{"Tags":["default"],"Nums":null,"Names":["y"]}`},
+		{msg: "too-many-repeated", args: []string{"--tag", "a", "--tag", "b", "--tag", "c", "--tag", "d"}, want: `{"Tags":["a","b","c"],"Nums":null,"Names":["x"]}`, wantErr: "must have at most 3 elements, but 4"},
+		{msg: "too-many-comma-separated", args: []string{"--num", "1,2,3"}, want: `{"Tags":["default"],"Nums":null,"Names":["x"]}`, wantErr: "must have at most 2 elements, but 3"},
+		{msg: "too-many-overwriting-default", args: []string{"--tag", "a,b,c,d"}, want: `{"Tags":["default"],"Nums":null,"Names":["x"]}`, wantErr: "must have at most 3 elements, but 4"},
+	}
+
+	for _, c := range cases {
+		c := c
+		t.Run(c.msg, func(t *testing.T) {
+			b := flagstruct.NewBuilder()
+			b.Name = "-"
+			b.EnvvarSupport = false
+			b.HandlingMode = pflag.ContinueOnError
+
+			options := &Options{Tags: []string{"default"}, Names: []string{"x"}}
+			fs := b.Build(options)
+			fs.SetOutput(io.Discard)
+
+			err := fs.Parse(c.args)
+			if c.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), c.wantErr) {
+					t.Errorf("want error %q, but got %+v", c.wantErr, err)
+				}
+				if b, _ := json.Marshal(options); c.want != string(b) { // restored
+					t.Errorf("want %s, but got %s", c.want, string(b))
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %+v", err)
+			}
+			if b, _ := json.Marshal(options); c.want != string(b) {
+				t.Errorf("want %s, but got %s", c.want, string(b))
+			}
+		})
+	}
+
+	t.Run("set-after-rejected", func(t *testing.T) {
+		b := flagstruct.NewBuilder()
+		b.Name = "-"
+		b.EnvvarSupport = false
+		b.HandlingMode = pflag.ContinueOnError
+
+		options := &Options{Tags: []string{"default"}}
+		fs := b.Build(options)
+		f := fs.Lookup("tag")
+		if _, ok := f.Value.(pflag.SliceValue); !ok {
+			t.Errorf("must be pflag.SliceValue, but %T", f.Value)
+		}
+		if err := f.Value.Set("a,b,c,d"); err == nil {
+			t.Fatalf("must be error, but nil")
+		}
+		if err := f.Value.Set("x"); err != nil {
+			t.Fatalf("unexpected error: %+v", err)
+		}
+		if err := f.Value.Set("y"); err != nil {
+			t.Fatalf("unexpected error: %+v", err)
+		}
+		if want, got := []string{"x", "y"}, options.Tags; !reflect.DeepEqual(want, got) {
+			t.Errorf("want %v, but got %v", want, got)
+		}
+	})
+
+	t.Run("config-file", func(t *testing.T) {
+		filename := filepath.Join(t.TempDir(), "config.json")
+		if err := os.WriteFile(filename, []byte(`{"Tags": ["from-file"]}`), 0600); err != nil {
+			t.Fatal(err)
+		}
+
+		b := flagstruct.NewBuilder()
+		b.Name = "-"
+		b.EnvvarSupport = false
+		b.HandlingMode = pflag.ContinueOnError
+
+		options := &Options{}
+		fs := b.Build(options)
+		if err := fs.LoadConfig(filename); err != nil {
+			t.Fatalf("unexpected error: %+v", err)
+		}
+		if err := fs.Parse([]string{"--tag", "a"}); err != nil {
+			t.Fatalf("unexpected error: %+v", err)
+		}
+		if want, got := []string{"a"}, options.Tags; !reflect.DeepEqual(want, got) {
+			t.Errorf("want %v, but got %v", want, got)
+		}
+	})
+}
+
+func TestBuilder_Build_MinLen(t *testing.T) {
+	type Options struct {
+		Tags []string `flag:"tag" minlen:"1"`
+		Nums []int    `flag:"num" minlen:"2"`
+	}
+
+	cases := []struct {
+		msg     string
+		args    []string
+		envs    map[string]string
+		want    string
+		wantErr string
+	}{
+		{msg: "ok", args: []string{"--tag", "a", "--num", "1,2"}, want: `{"Tags":["a"],"Nums":[1,2]}`},
+		{msg: "envvar", args: []string{"--num", "1", "--num", "2"}, envs: map[string]string{"TAG": "a,b"}, want: `{"Tags":["a","b"],"Nums":[1,2]}`},
+		{msg: "empty", args: []string{"--num", "1,2"}, wantErr: "flag --tag must have at least 1 elements, but 0"},
+		{msg: "too-few", args: []string{"--tag", "a", "--num", "1"}, wantErr: "flag --num must have at least 2 elements, but 1"},
+	}
+
+	for _, c := range cases {
+		c := c
+		t.Run(c.msg, func(t *testing.T) {
+			for k, v := range c.envs {
+				t.Setenv(k, v)
+			}
+
+			b := flagstruct.NewBuilder()
+			b.Name = "-"
+			b.EnvPrefix = ""
+			b.HandlingMode = pflag.ContinueOnError
+
+			options := &Options{}
+			fs := b.Build(options)
+			fs.SetOutput(io.Discard)
+
+			err := fs.Parse(c.args)
+			if c.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), c.wantErr) {
+					t.Errorf("want error %q, but got %+v", c.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %+v", err)
+			}
+			if b, _ := json.Marshal(options); c.want != string(b) {
+				t.Errorf("want %s, but got %s", c.want, string(b))
+			}
+		})
+	}
+}
+
+func TestBuilder_Build_OneOf(t *testing.T) {
+	type Options struct {
+		Priority string `flag:"priority" oneof:"low,medium,high" oneofci:"true"`
+		Format   string `flag:"format" oneof:"json,YAML"`
+	}
+
+	cases := []struct {
+		msg     string
+		args    []string
+		want    string
+		wantErr string
+	}{
+		{msg: "exact", args: []string{"--priority", "medium", "--format", "YAML"}, want: `{"Priority":"medium","Format":"YAML"}`},
+		{msg: "case-insensitive", args: []string{"--priority", "HiGh"}, want: `{"Priority":"high","Format":"json"}`},
+		{msg: "case-sensitive", args: []string{"--format", "yaml"}, wantErr: "must be one of json, YAML"},
+		{msg: "not-allowed", args: []string{"--priority", "urgent"}, wantErr: "must be one of low, medium, high"},
+	}
+
+	for _, c := range cases {
+		c := c
+		t.Run(c.msg, func(t *testing.T) {
+			b := flagstruct.NewBuilder()
+			b.Name = "-"
+			b.EnvvarSupport = false
+			b.HandlingMode = pflag.ContinueOnError
+
+			options := &Options{Priority: "low", Format: "json"}
+			fs := b.Build(options)
+			fs.SetOutput(io.Discard)
+
+			err := fs.Parse(c.args)
+			if c.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), c.wantErr) {
+					t.Errorf("want error %q, but got %+v", c.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %+v", err)
+			}
+			if b, _ := json.Marshal(options); c.want != string(b) {
+				t.Errorf("want %s, but got %s", c.want, string(b))
+			}
+		})
+	}
+
+	t.Run("help", func(t *testing.T) {
+		b := flagstruct.NewBuilder()
+		b.Name = "-"
+		b.EnvvarSupport = false
+
+		fs := b.Build(&Options{})
+		if want, got := "(allowed: low, medium, high)", fs.Lookup("priority").Usage; !strings.Contains(got, want) {
+			t.Errorf("usage must include %q, but got %q", want, got)
+		}
+	})
+}
+
+func TestBuilder_Build_HelpTextFunc(t *testing.T) {
+	type Options struct {
+		Name    string `flag:"name" help:"name of the user"`
+		Verbose bool   `flag:"verbose" help:"verbose output"`
+		Nested  struct {
+			URI string `flag:"uri" help:"uri of the database"`
+		} `flag:"db"`
+		NoHelp string `flag:"no-help"`
+	}
+
+	b := flagstruct.NewBuilder()
+	b.Name = "-"
+	b.EnvPrefix = "X_"
+	b.HandlingMode = pflag.ContinueOnError
+	b.HelpTextFunc = strings.ToUpper
+
+	fs := b.Build(&Options{})
+
+	cases := map[string]string{
+		"name":    "NAME OF THE USER",
+		"verbose": "VERBOSE OUTPUT",
+		"db.uri":  "URI OF THE DATABASE",
+		"no-help": "-",
+	}
+	for name, want := range cases {
+		got := fs.Lookup(name).Usage
+		if !strings.HasPrefix(got, "ENV: X_") || !strings.HasSuffix(got, want) {
+			t.Errorf("usage of --%s must be transformed %q (with the envvar annotation), but got %q", name, want, got)
+		}
+	}
+}
+
+func TestBuilder_Build_StructMap(t *testing.T) {
+	type Server struct {
+		Host string `flag:"host"`
+		Port int    `flag:"port"`
+		TLS  bool   `flag:"tls"`
+	}
+	type Options struct {
+		Servers map[string]Server `flag:"servers"`
+	}
+
+	cases := []struct {
+		msg     string
+		args    []string
+		want    string
+		wantErr string
+	}{
+		{msg: "default", args: []string{}, want: `{"Servers":{"web":{"Host":"localhost","Port":80,"TLS":false}}}`},
+		{msg: "two-keys", args: []string{"--servers.web.port", "8080", "--servers.db.port", "5432", "--servers.db.tls"}, want: `{"Servers":{"db":{"Host":"","Port":5432,"TLS":true},"web":{"Host":"localhost","Port":8080,"TLS":false}}}`},
+		{msg: "with-equal", args: []string{"--servers.cache.host=127.0.0.1"}, want: `{"Servers":{"cache":{"Host":"127.0.0.1","Port":0,"TLS":false},"web":{"Host":"localhost","Port":80,"TLS":false}}}`},
+		{msg: "unknown-field", args: []string{"--servers.db.user", "foo"}, wantErr: "unknown flag: --servers.db.user"},
+		{msg: "invalid-value", args: []string{"--servers.db.port", "x"}, wantErr: "invalid argument"},
+	}
+
+	for _, c := range cases {
+		c := c
+		t.Run(c.msg, func(t *testing.T) {
+			b := flagstruct.NewBuilder()
+			b.Name = "-"
+			b.EnvvarSupport = false
+			b.HandlingMode = pflag.ContinueOnError
+
+			options := &Options{Servers: map[string]Server{"web": {Host: "localhost", Port: 80}}}
+			fs := b.Build(options)
+			fs.SetOutput(io.Discard)
+
+			err := fs.Parse(c.args)
+			if c.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), c.wantErr) {
+					t.Errorf("want error %q, but got %+v", c.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %+v", err)
+			}
+			if b, _ := json.Marshal(options); c.want != string(b) {
+				t.Errorf("want %s, but got %s", c.want, string(b))
+			}
+		})
+	}
+}
+
+func TestBuilder_Build_ShorthandInFlagTag(t *testing.T) {
+	type Options struct {
+		Verbose bool   `flag:"verbose,v"`
+		Name    string `flag:"name,n" short:"N"`
+		Output  string `json:"output,omitempty"`
+	}
+
+	b := flagstruct.NewBuilder()
+	b.Name = "-"
+	b.EnvvarSupport = false
+	b.HandlingMode = pflag.ContinueOnError
+	b.ShorthandInFlagTag = true
+	b.FlagnameTags = append(b.FlagnameTags, "json")
+
+	options := &Options{}
+	fs := b.Build(options)
+
+	cases := map[string]string{"verbose": "v", "name": "N", "output": ""}
+	for name, want := range cases {
+		f := fs.Lookup(name)
+		if f == nil {
+			t.Errorf("--%s is not found", name)
+			continue
+		}
+		if got := f.Shorthand; want != got {
+			t.Errorf("want shorthand of --%s is %q, but got %q", name, want, got)
+		}
+	}
+
+	if err := fs.Parse([]string{"-v", "-N", "foo", "--output", "out.txt"}); err != nil {
+		t.Fatalf("unexpected error: %+v", err)
+	}
+	want := `{"Verbose":true,"Name":"foo","output":"out.txt"}`
+	if b, _ := json.Marshal(options); want != string(b) {
+		t.Errorf("want %s, but got %s", want, string(b))
+	}
+
+	t.Run("disabled", func(t *testing.T) {
+		b := flagstruct.NewBuilder()
+		b.Name = "-"
+		b.EnvvarSupport = false
+		b.HandlingMode = pflag.ContinueOnError
+
+		fs := b.Build(&Options{})
+		if f := fs.Lookup("verbose"); f == nil || f.Shorthand != "" {
+			t.Errorf("--verbose must not have the shorthand, but %+v", f)
+		}
+	})
+}
+
+func TestBuilder_Build_DeprecatedGroup(t *testing.T) {
+	type Legacy struct {
+		Host  string `flag:"host"`
+		Inner struct {
+			Port int `flag:"port"`
+		} `flag:"inner"`
+	}
+	type Options struct {
+		Name   string `flag:"name"`
+		Old    string `flag:"old" deprecated:"use --name instead"`
+		Legacy Legacy `flag:"legacy" deprecated:"the legacy backend is removed in v2"`
+	}
+
+	b := flagstruct.NewBuilder()
+	b.Name = "-"
+	b.EnvvarSupport = false
+	b.HandlingMode = pflag.ContinueOnError
+
+	options := &Options{}
+	fs := b.Build(options)
+
+	cases := map[string]string{
+		"name":              "",
+		"old":               "use --name instead",
+		"legacy.host":       "the legacy backend is removed in v2",
+		"legacy.inner.port": "the legacy backend is removed in v2",
+	}
+	for name, want := range cases {
+		if got := fs.Lookup(name).Deprecated; want != got {
+			t.Errorf("want deprecation of --%s is %q, but got %q", name, want, got)
+		}
+	}
+	if usage := fs.FlagUsages(); strings.Contains(usage, "legacy") {
+		t.Errorf("deprecated flags must be hidden in usage, but got\n%s", usage)
+	}
+
+	var buf strings.Builder
+	fs.SetOutput(&buf)
+	if err := fs.Parse([]string{"--legacy.inner.port", "8080"}); err != nil {
+		t.Fatalf("unexpected error: %+v", err)
+	}
+	if want, got := 8080, options.Legacy.Inner.Port; want != got {
+		t.Errorf("want %v, but got %v", want, got)
+	}
+	if want, got := "Flag --legacy.inner.port has been deprecated, the legacy backend is removed in v2", buf.String(); !strings.Contains(got, want) {
+		t.Errorf("want warning %q, but got %q", want, got)
+	}
+}
+
+func TestBuilder_Build_AllowSlashFlags(t *testing.T) {
+	type Options struct {
+		Name    string `flag:"name"`
+		Dir     string `flag:"dir"`
+		Verbose bool   `flag:"verbose" short:"v"`
+	}
+
+	cases := []struct {
+		msg  string
+		args []string
+		want string
+		rest []string
+	}{
+		{msg: "slash", args: []string{"/name", "foo", "/verbose"}, want: `{"Name":"foo","Dir":"","Verbose":true}`},
+		{msg: "slash-with-colon", args: []string{"/name:foo", "/dir=/tmp"}, want: `{"Name":"foo","Dir":"/tmp","Verbose":false}`},
+		{msg: "shorthand", args: []string{"/v"}, want: `{"Name":"","Dir":"","Verbose":true}`},
+		{msg: "mixed", args: []string{"--name", "foo", "/dir", "/name", "-v", "/usr/local"}, want: `{"Name":"foo","Dir":"/name","Verbose":true}`, rest: []string{"/usr/local"}},
+		{msg: "path", args: []string{"/usr/local", "/name:x", "--", "/verbose"}, want: `{"Name":"x","Dir":"","Verbose":false}`, rest: []string{"/usr/local", "/verbose"}},
+	}
+
+	for _, c := range cases {
+		c := c
+		t.Run(c.msg, func(t *testing.T) {
+			b := flagstruct.NewBuilder()
+			b.Name = "-"
+			b.EnvvarSupport = false
+			b.HandlingMode = pflag.ContinueOnError
+			b.AllowSlashFlags = true
+
+			options := &Options{}
+			fs := b.Build(options)
+			if err := fs.Parse(c.args); err != nil {
+				t.Fatalf("unexpected error: %+v", err)
+			}
+			if b, _ := json.Marshal(options); c.want != string(b) {
+				t.Errorf("want %s, but got %s", c.want, string(b))
+			}
+			if got := fs.Args(); len(c.rest) != len(got) || (len(got) > 0 && !reflect.DeepEqual(c.rest, got)) {
+				t.Errorf("want rest args %v, but got %v", c.rest, got)
+			}
+		})
+	}
+}
+
+func TestBuilder_MinArgs_MaxArgs(t *testing.T) {
+	type Options struct {
+		Verbose bool `flag:"verbose"`
+	}
+
+	cases := []struct {
+		msg     string
+		args    []string
+		wantErr string
+	}{
+		{msg: "min", args: []string{"a"}},
+		{msg: "max", args: []string{"--verbose", "a", "b", "c"}},
+		{msg: "too-few", args: []string{"--verbose"}, wantErr: "requires at least 1 arg(s), only received 0"},
+		{msg: "too-many", args: []string{"a", "b", "--verbose", "c", "d"}, wantErr: "accepts at most 3 arg(s), received 4"},
+		{msg: "too-many-after-dash", args: []string{"a", "--", "b", "c", "d"}, wantErr: "accepts at most 3 arg(s), received 4"},
+	}
+
+	for _, c := range cases {
+		c := c
+		t.Run(c.msg, func(t *testing.T) {
+			b := flagstruct.NewBuilder()
+			b.Name = "-"
+			b.EnvvarSupport = false
+			b.HandlingMode = pflag.ContinueOnError
+			b.MinArgs(1)
+			b.MaxArgs(3)
+
+			fs := b.Build(&Options{})
+			err := fs.Parse(c.args)
+			if c.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), c.wantErr) {
+					t.Errorf("want error %q, but got %+v", c.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %+v", err)
+			}
+		})
+	}
+
+	t.Run("no-args", func(t *testing.T) {
+		b := flagstruct.NewBuilder()
+		b.Name = "-"
+		b.EnvvarSupport = false
+		b.HandlingMode = pflag.ContinueOnError
+		b.MaxArgs(0)
+
+		fs := b.Build(&Options{})
+		if err := fs.Parse([]string{"--verbose"}); err != nil {
+			t.Errorf("unexpected error: %+v", err)
+		}
+		if err := fs.Parse([]string{"a"}); err == nil {
+			t.Errorf("want error, but nil")
+		}
+	})
+
+	t.Run("passthrough", func(t *testing.T) {
+		type Options struct {
+			Name    string   `flag:"name"`
+			Command []string `passthrough:"true"`
+		}
+
+		b := flagstruct.NewBuilder()
+		b.Name = "-"
+		b.EnvvarSupport = false
+		b.HandlingMode = pflag.ContinueOnError
+		b.MaxArgs(0)
+
+		options := &Options{}
+		fs := b.Build(options)
+		if err := fs.Parse([]string{"--name", "x", "--", "ls", "-l"}); err != nil {
+			t.Fatalf("unexpected error: %+v", err)
+		}
+		if want, got := []string{"ls", "-l"}, options.Command; !reflect.DeepEqual(want, got) {
+			t.Errorf("want %v, but got %v", want, got)
+		}
+		if err := fs.Parse([]string{"--name", "x", "a", "--", "ls"}); err == nil {
+			t.Errorf("want error, but nil")
+		}
+	})
+}
+
+// test for enum
+
+type LogLevel string
+
+const (
+	LogLevelDebug   LogLevel = "DEBUG"
+	LogLevelInfo    LogLevel = "INFO"
+	LogLevelWarning LogLevel = "WARN"
+	LogLevelError   LogLevel = "ERROR"
+)
+
+func (v LogLevel) Validate() error {
+	switch v {
+	case "DEBUG", "INFO", "WARN", "ERROR":
+		return nil
+	default:
+		return fmt.Errorf("%v is an invalid value for %v", v, reflect.TypeOf(v))
+	}
+}
+
+// for flagstruct.HasHelpText
+func (v LogLevel) HelpText() string {
+	return "log level {DEBUG, INFO, WARN, ERROR}"
+}
+
+// for flagstruct.HasAllowedValues
+func (v LogLevel) AllowedValues() []string {
+	return []string{string(LogLevelDebug), string(LogLevelInfo), string(LogLevelWarning), string(LogLevelError)}
 }
 
 // for pflag.Value
@@ -0,0 +1,94 @@
+// Package flagstructcobra provides the integration with cobra. (isolated from the core package, not to depend on cobra)
+package flagstructcobra
+
+import (
+	"github.com/podhmo/flagstruct"
+	"github.com/spf13/cobra"
+	flag "github.com/spf13/pflag"
+)
+
+// AttachToCobra binds the struct's flags to cmd.Flags(), with flagstruct.Builder.BuildInto.
+// the fields tagged with `persistent:"true"` are bound to cmd.PersistentFlags() instead (inherited by the sub commands).
+//
+// cobra parses the command-line arguments, and the rest of parsing (envvars, required flags) is run in cmd.PreRunE.
+// if any field is persistent, it is run in cmd.PersistentPreRunE instead, because cobra doesn't call the parent's PreRunE for the sub commands.
+// cobra calls only the nearest PersistentPreRunE, so the ones of the sub commands are also wrapped (on cobra's initialization, before running).
+// in the sub commands, the required flags of cmd's own (not persistent) flags are not checked.
+// the existing hook (PreRunE/PreRun, or PersistentPreRunE/PersistentPreRun) is called after that, so please set it before attaching.
+func AttachToCobra(cmd *cobra.Command, o interface{}, options ...func(*flagstruct.Builder)) *flagstruct.FlagSet {
+	b := flagstruct.NewBuilder()
+	b.Name = cmd.Name()
+	b.HandlingMode = flag.ContinueOnError // the error is handled by cobra
+	for _, opt := range options {
+		opt(b)
+	}
+	fs := b.BuildInto(flag.NewFlagSet(b.Name, b.HandlingMode), o)
+
+	// the *flag.Flag is shared, so the values parsed by cobra are visible from fs
+	persistent := map[string]bool{}
+	for _, info := range fs.Binder.AllFields() {
+		if info.Persistent {
+			persistent[info.Name] = true
+		}
+	}
+	fs.VisitAll(func(f *flag.Flag) {
+		if persistent[f.Name] {
+			cmd.PersistentFlags().AddFlag(f)
+		} else {
+			cmd.Flags().AddFlag(f)
+		}
+	})
+
+	if len(persistent) == 0 {
+		cmd.PreRunE = completeBefore(fs, cmd, cmd.PreRunE, cmd.PreRun)
+		return fs
+	}
+
+	cmd.PersistentPreRunE = completeBefore(fs, cmd, cmd.PersistentPreRunE, cmd.PersistentPreRun)
+	wrapped := map[*cobra.Command]bool{cmd: true}
+	cobra.OnInitialize(func() {
+		// the sub commands may be added after attaching
+		var walk func(*cobra.Command)
+		walk = func(c *cobra.Command) {
+			for _, sub := range c.Commands() {
+				if !wrapped[sub] && (sub.PersistentPreRunE != nil || sub.PersistentPreRun != nil) {
+					wrapped[sub] = true
+					sub.PersistentPreRunE = completeBefore(fs, cmd, sub.PersistentPreRunE, sub.PersistentPreRun)
+				}
+				walk(sub)
+			}
+		}
+		walk(cmd)
+	})
+	return fs
+}
+
+// completeBefore returns the hook running fs.Complete(), and then the existing hook. (run is ignored by cobra, if runE is set)
+func completeBefore(fs *flagstruct.FlagSet, attached *cobra.Command, runE func(*cobra.Command, []string) error, run func(*cobra.Command, []string)) func(*cobra.Command, []string) error {
+	return func(cmd *cobra.Command, args []string) error {
+		if err := complete(fs, attached, cmd); err != nil {
+			return err
+		}
+		if runE != nil {
+			return runE(cmd, args)
+		}
+		if run != nil {
+			run(cmd, args)
+		}
+		return nil
+	}
+}
+
+// complete runs fs.Complete() for the running command.
+// (in the sub commands, the attached command's own flags are not parsed, so they are treated as set only for the required check)
+func complete(fs *flagstruct.FlagSet, attached *cobra.Command, running *cobra.Command) error {
+	if running != attached {
+		for _, name := range fs.Binder.AllRequiredFlagNames() {
+			if f := attached.LocalNonPersistentFlags().Lookup(name); f != nil && !f.Changed {
+				f.Changed = true
+				defer func(f *flag.Flag) { f.Changed = false }(f)
+			}
+		}
+	}
+	return fs.Complete()
+}
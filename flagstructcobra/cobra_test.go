@@ -0,0 +1,205 @@
+package flagstructcobra_test
+
+import (
+	"encoding/json"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/podhmo/flagstruct"
+	"github.com/podhmo/flagstruct/flagstructcobra"
+	"github.com/spf13/cobra"
+)
+
+func TestAttachToCobra(t *testing.T) {
+	type Options struct {
+		Name    string `flag:"name" required:"true"`
+		Verbose bool   `flag:"verbose"`
+	}
+
+	cases := []struct {
+		msg     string
+		args    []string
+		envs    map[string]string
+		want    string
+		wantErr string
+	}{
+		{msg: "args", args: []string{"--name", "foo", "--verbose"}, want: `{"Name":"foo","Verbose":true}`},
+		{msg: "envvar", args: []string{}, envs: map[string]string{"NAME": "bar"}, want: `{"Name":"bar","Verbose":false}`},
+		{msg: "required", args: []string{}, wantErr: "name"},
+	}
+
+	for _, c := range cases {
+		c := c
+		t.Run(c.msg, func(t *testing.T) {
+			for k, v := range c.envs {
+				t.Setenv(k, v)
+			}
+
+			var called bool
+			options := &Options{}
+			cmd := &cobra.Command{
+				Use: "hello",
+				PreRun: func(cmd *cobra.Command, args []string) {
+					called = true
+				},
+				RunE: func(cmd *cobra.Command, args []string) error {
+					return nil
+				},
+			}
+			cmd.SetArgs(c.args)
+			cmd.SetOut(io.Discard)
+			cmd.SetErr(io.Discard)
+
+			flagstructcobra.AttachToCobra(cmd, options, func(b *flagstruct.Builder) {
+				b.EnvPrefix = ""
+			})
+
+			err := cmd.Execute()
+			if c.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), c.wantErr) {
+					t.Errorf("want error %q, but got %+v", c.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %+v", err)
+			}
+			if !called {
+				t.Errorf("the original PreRun must be called")
+			}
+			if b, _ := json.Marshal(options); c.want != string(b) {
+				t.Errorf("want %s, but got %s", c.want, string(b))
+			}
+		})
+	}
+}
+
+func TestAttachToCobra_Persistent(t *testing.T) {
+	type Options struct {
+		Debug bool   `flag:"debug" persistent:"true"`
+		Name  string `flag:"name"`
+	}
+
+	options := &Options{}
+	rootCmd := &cobra.Command{Use: "root"}
+	flagstructcobra.AttachToCobra(rootCmd, options)
+
+	var ran bool
+	subCmd := &cobra.Command{
+		Use: "sub",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ran = true
+			return nil
+		},
+	}
+	rootCmd.AddCommand(subCmd)
+
+	if rootCmd.PersistentFlags().Lookup("debug") == nil {
+		t.Errorf("--debug must be a persistent flag")
+	}
+	if rootCmd.PersistentFlags().Lookup("name") != nil || rootCmd.LocalNonPersistentFlags().Lookup("name") == nil {
+		t.Errorf("--name must be a local flag")
+	}
+
+	rootCmd.SetArgs([]string{"sub", "--debug"})
+	rootCmd.SetOut(io.Discard)
+	rootCmd.SetErr(io.Discard)
+	if err := rootCmd.Execute(); err != nil {
+		t.Fatalf("unexpected error: %+v", err)
+	}
+	if !ran {
+		t.Errorf("the sub command must be run")
+	}
+	if !options.Debug {
+		t.Errorf("want debug=true (inherited by the sub command), but false")
+	}
+
+	rootCmd.SetArgs([]string{"sub", "--name", "foo"})
+	if err := rootCmd.Execute(); err == nil || !strings.Contains(err.Error(), "unknown flag: --name") {
+		t.Errorf("--name must not be inherited, but got %+v", err)
+	}
+}
+
+func TestAttachToCobra_PersistentEnvvar(t *testing.T) {
+	type Options struct {
+		Token string `flag:"token" persistent:"true"`
+		Name  string `flag:"name"`
+	}
+
+	t.Setenv("TOKEN", "from-env")
+
+	options := &Options{}
+	var called bool
+	rootCmd := &cobra.Command{
+		Use: "root",
+		PersistentPreRun: func(cmd *cobra.Command, args []string) {
+			called = true
+		},
+	}
+	flagstructcobra.AttachToCobra(rootCmd, options, func(b *flagstruct.Builder) {
+		b.EnvPrefix = ""
+	})
+	rootCmd.AddCommand(&cobra.Command{
+		Use:  "sub",
+		RunE: func(cmd *cobra.Command, args []string) error { return nil },
+	})
+
+	rootCmd.SetArgs([]string{"sub"})
+	rootCmd.SetOut(io.Discard)
+	rootCmd.SetErr(io.Discard)
+	if err := rootCmd.Execute(); err != nil {
+		t.Fatalf("unexpected error: %+v", err)
+	}
+	if want, got := "from-env", options.Token; want != got {
+		t.Errorf("want token=%q (from envvar, in the sub command), but got %q", want, got)
+	}
+	if !called {
+		t.Errorf("the original PersistentPreRun must be called")
+	}
+}
+
+func TestAttachToCobra_SubPersistentPreRunE(t *testing.T) {
+	type Options struct {
+		Token string `flag:"token" persistent:"true"`
+		Name  string `flag:"name" required:"true"` // only for the root command
+	}
+
+	t.Setenv("TOKEN", "from-env")
+
+	options := &Options{}
+	rootCmd := &cobra.Command{
+		Use:  "root",
+		RunE: func(cmd *cobra.Command, args []string) error { return nil },
+	}
+	flagstructcobra.AttachToCobra(rootCmd, options, func(b *flagstruct.Builder) {
+		b.EnvPrefix = ""
+	})
+
+	// the sub command's PersistentPreRunE is set after attaching (cobra doesn't call the root's one)
+	var token string
+	rootCmd.AddCommand(&cobra.Command{
+		Use: "sub",
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+			token = options.Token
+			return nil
+		},
+		RunE: func(cmd *cobra.Command, args []string) error { return nil },
+	})
+
+	rootCmd.SetArgs([]string{"sub"})
+	rootCmd.SetOut(io.Discard)
+	rootCmd.SetErr(io.Discard)
+	if err := rootCmd.Execute(); err != nil {
+		t.Fatalf("unexpected error: %+v", err)
+	}
+	if want, got := "from-env", token; want != got {
+		t.Errorf("want token=%q (completed before the sub command's hook), but got %q", want, got)
+	}
+
+	// the required flag of the root command is still checked, in the root command
+	rootCmd.SetArgs([]string{})
+	if err := rootCmd.Execute(); err == nil || !strings.Contains(err.Error(), `"name"`) {
+		t.Errorf("want required error of --name, but got %+v", err)
+	}
+}
@@ -0,0 +1,37 @@
+package flagstruct
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	flag "github.com/spf13/pflag"
+)
+
+// for reading the value from a file, e.g. `--token @/path/to/token` or `--token file:///path/to/token`
+// (the field is tagged with `fromfile:"true"`, useful for secrets not to put them in argv)
+//
+// the trailing newline of the file is trimmed.
+// with Config.ExpandResponseFiles, please use `--token=@/path/to/token` (the argument beginning with "@" is a response file).
+
+type fromFileValue struct {
+	flag.Value
+}
+
+func (v *fromFileValue) Set(s string) error {
+	var filename string
+	switch {
+	case strings.HasPrefix(s, "@") && len(s) > 1:
+		filename = s[1:]
+	case strings.HasPrefix(s, "file://"):
+		filename = strings.TrimPrefix(s, "file://")
+	default:
+		return v.Value.Set(s)
+	}
+
+	b, err := os.ReadFile(filename)
+	if err != nil {
+		return fmt.Errorf("on reading value from file, %w", err)
+	}
+	return v.Value.Set(strings.TrimRight(string(b), "\r\n"))
+}
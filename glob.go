@@ -0,0 +1,42 @@
+package flagstruct
+
+import (
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"unsafe"
+)
+
+// for glob expansion of file arguments, e.g. `--files *.go` (the field is []string with `glob:"true"`)
+//
+// the patterns are expanded after parsing (useful on Windows, where the shell doesn't expand them).
+// the pattern matching nothing is dropped, unless Config.KeepUnmatchedGlob is true.
+
+func (b *Binder) expandGlobFields() error {
+	for _, fv := range b.State.globFields {
+		ref := (*[]string)(unsafe.Pointer(fv.UnsafeAddr()))
+		expanded := make([]string, 0, len(*ref))
+		for _, pattern := range *ref {
+			if !strings.ContainsAny(pattern, "*?[") {
+				expanded = append(expanded, pattern)
+				continue
+			}
+			matches, err := filepath.Glob(pattern)
+			if err != nil {
+				return fmt.Errorf("on glob %q, %w", pattern, err)
+			}
+			if len(matches) == 0 && b.KeepUnmatchedGlob {
+				expanded = append(expanded, pattern)
+				continue
+			}
+			expanded = append(expanded, matches...)
+		}
+		*ref = expanded
+	}
+	return nil
+}
+
+func isGlobFieldType(rt reflect.Type) bool {
+	return rt.Kind() == reflect.Slice && rt.Elem().Kind() == reflect.String
+}
@@ -0,0 +1,138 @@
+package flagstruct
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// for nested struct populated from a single flag, e.g. `--opts timeout=5s,retries=3`
+// (the struct field is tagged with `inline:"kv"`)
+//
+// the key is matched with the flag name of the field (or the Go field name, case-insensitively).
+// the supported leaf types are string, bool, int, int64, uint, float64 and time.Duration.
+
+type kvStructValue struct {
+	v      reflect.Value // addressable struct value
+	keys   []string      // the keys, in field order
+	fields map[string]int
+}
+
+func (b *Binder) newKVStructValue(rt reflect.Type, fv reflect.Value) *kvStructValue {
+	v := &kvStructValue{v: fv, fields: map[string]int{}}
+	for i := 0; i < rt.NumField(); i++ {
+		rf := rt.Field(i)
+		if !rf.IsExported() {
+			continue
+		}
+		switch rf.Type.Kind() {
+		case reflect.String, reflect.Bool, reflect.Int, reflect.Int64, reflect.Uint, reflect.Float64:
+		default:
+			panic(fmt.Sprintf("unsupported type %v of field %s.%s (inline kv)", rf.Type, rt, rf.Name))
+		}
+
+		key, _, skip := b.lookupFlagname(rf, "")
+		if skip {
+			continue
+		}
+		v.keys = append(v.keys, key)
+		v.fields[key] = i
+	}
+	return v
+}
+
+func (v *kvStructValue) Set(s string) error {
+	for _, pair := range strings.Split(s, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		parts := strings.SplitN(pair, "=", 2)
+		if len(parts) != 2 {
+			return fmt.Errorf("%q must be formatted as key=value", pair)
+		}
+
+		key := strings.TrimSpace(parts[0])
+		i, ok := v.lookup(key)
+		if !ok {
+			return fmt.Errorf("unknown key %q (available keys: %s)", key, strings.Join(v.keys, ", "))
+		}
+		if err := setKVField(v.v.Field(i), strings.TrimSpace(parts[1])); err != nil {
+			return fmt.Errorf("on key %s, %w", key, err)
+		}
+	}
+	return nil
+}
+
+func (v *kvStructValue) lookup(key string) (int, bool) {
+	if i, ok := v.fields[key]; ok {
+		return i, true
+	}
+	rt := v.v.Type()
+	for _, i := range v.fields {
+		if strings.EqualFold(rt.Field(i).Name, key) {
+			return i, true
+		}
+	}
+	return 0, false
+}
+
+func setKVField(fv reflect.Value, s string) error {
+	if fv.Type() == rTimeDurationType {
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return err
+		}
+		fv.SetInt(int64(d))
+		return nil
+	}
+
+	switch fv.Kind() {
+	case reflect.String:
+		fv.SetString(s)
+	case reflect.Bool:
+		x, err := strconv.ParseBool(s)
+		if err != nil {
+			return err
+		}
+		fv.SetBool(x)
+	case reflect.Int, reflect.Int64:
+		x, err := strconv.ParseInt(s, 0, fv.Type().Bits())
+		if err != nil {
+			return err
+		}
+		fv.SetInt(x)
+	case reflect.Uint:
+		x, err := strconv.ParseUint(s, 0, fv.Type().Bits())
+		if err != nil {
+			return err
+		}
+		fv.SetUint(x)
+	case reflect.Float64:
+		x, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return err
+		}
+		fv.SetFloat(x)
+	}
+	return nil
+}
+
+func (v *kvStructValue) String() string {
+	pairs := make([]string, 0, len(v.keys))
+	for _, key := range v.keys {
+		fv := v.v.Field(v.fields[key])
+		if fv.IsZero() {
+			continue
+		}
+		pairs = append(pairs, fmt.Sprintf("%s=%v", key, fv.Interface()))
+	}
+	return strings.Join(pairs, ",")
+}
+
+// for pflag.Value
+func (v *kvStructValue) Type() string {
+	return "key=value"
+}
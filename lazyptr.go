@@ -0,0 +1,96 @@
+package flagstruct
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"time"
+)
+
+// for lazy pointer allocation (Config.LazyPointerAlloc), e.g. *int
+//
+// the pointer field is allocated on Set, so it remains nil if the flag is not provided.
+
+type lazyPtrValue struct {
+	ptr reflect.Value // addressable pointer value
+}
+
+func newLazyPtrValue(fv reflect.Value) *lazyPtrValue {
+	if !canAllocLazily(fv.Type().Elem()) {
+		panic(fmt.Sprintf("unsupported type %v (for lazy pointer allocation)", fv.Type()))
+	}
+	return &lazyPtrValue{ptr: fv}
+}
+
+// canAllocLazily returns true if the pointer to rt can be allocated lazily. (the others are allocated eagerly, e.g. *[]string)
+func canAllocLazily(rt reflect.Type) bool {
+	switch rt.Kind() {
+	case reflect.Bool, reflect.Int, reflect.Int64, reflect.Uint, reflect.Uint64, reflect.Float64, reflect.String:
+		return true
+	default:
+		return false
+	}
+}
+
+func (v *lazyPtrValue) Set(s string) error {
+	rt := v.ptr.Type().Elem()
+	ev := reflect.New(rt).Elem()
+	switch rt.Kind() {
+	case reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return err
+		}
+		ev.SetBool(b)
+	case reflect.Int, reflect.Int64:
+		if rt == rTimeDurationType {
+			d, err := time.ParseDuration(s)
+			if err != nil {
+				return err
+			}
+			ev.SetInt(int64(d))
+			break
+		}
+		n, err := strconv.ParseInt(s, 0, rt.Bits())
+		if err != nil {
+			return err
+		}
+		ev.SetInt(n)
+	case reflect.Uint, reflect.Uint64:
+		n, err := strconv.ParseUint(s, 0, rt.Bits())
+		if err != nil {
+			return err
+		}
+		ev.SetUint(n)
+	case reflect.Float64:
+		f, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return err
+		}
+		ev.SetFloat(f)
+	case reflect.String:
+		ev.SetString(s)
+	}
+
+	if v.ptr.IsNil() {
+		v.ptr.Set(reflect.New(rt))
+	}
+	v.ptr.Elem().Set(ev)
+	return nil
+}
+
+func (v *lazyPtrValue) String() string {
+	if v.ptr.IsNil() {
+		return "<nil>"
+	}
+	return fmt.Sprint(v.ptr.Elem().Interface())
+}
+
+// for pflag.Value
+func (v *lazyPtrValue) Type() string {
+	rt := v.ptr.Type().Elem()
+	if rt == rTimeDurationType {
+		return "duration"
+	}
+	return rt.Kind().String()
+}
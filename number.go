@@ -0,0 +1,48 @@
+package flagstruct
+
+import (
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// for flexible numbers (Config.FlexibleNumbers), e.g. `--mask 0xFF`, `--count 1_000_000`
+//
+// the underscores are stripped before parsing, and the base is detected by the prefix (0x, 0o, 0b).
+
+type flexibleNumberValue struct {
+	v reflect.Value // addressable int/uint value
+}
+
+func (v *flexibleNumberValue) Set(s string) error {
+	s = strings.ReplaceAll(strings.TrimSpace(s), "_", "")
+	switch v.v.Kind() {
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(s, 0, v.v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.v.SetUint(n)
+	default:
+		n, err := strconv.ParseInt(s, 0, v.v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.v.SetInt(n)
+	}
+	return nil
+}
+
+func (v *flexibleNumberValue) String() string {
+	switch v.v.Kind() {
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return strconv.FormatUint(v.v.Uint(), 10)
+	default:
+		return strconv.FormatInt(v.v.Int(), 10)
+	}
+}
+
+// for pflag.Value
+func (v *flexibleNumberValue) Type() string {
+	return v.v.Kind().String() // e.g. int, uint64
+}
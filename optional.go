@@ -0,0 +1,46 @@
+package flagstruct
+
+import (
+	"reflect"
+
+	flag "github.com/spf13/pflag"
+)
+
+// Optional is a value with the presence, Valid is true if the flag is set (by command-line, envvar, etc).
+type Optional[T any] struct {
+	Value T
+	Valid bool
+}
+
+func (o *Optional[T]) optionalFields() (value reflect.Value, valid *bool) {
+	return reflect.ValueOf(&o.Value).Elem(), &o.Valid
+}
+
+type optionalField interface {
+	optionalFields() (value reflect.Value, valid *bool)
+}
+
+// optionalValue sets valid on Set, wrapping the value of the inner field.
+type optionalValue struct {
+	flag.Value
+	valid *bool
+}
+
+func (v *optionalValue) Set(s string) error {
+	if err := v.Value.Set(s); err != nil {
+		return err
+	}
+	*v.valid = true
+	return nil
+}
+
+// bindOptional binds the inner value of Optional[T], the flags are registered via the temporary FlagSet for wrapping.
+func (b *Binder) bindOptional(fs *flag.FlagSet, impl optionalField, c fieldcontext) {
+	value, valid := impl.optionalFields()
+	tmp := flag.NewFlagSet("", flag.ContinueOnError)
+	b.walkField(tmp, value.Type(), value, c)
+	tmp.VisitAll(func(f *flag.Flag) {
+		f.Value = &optionalValue{Value: f.Value, valid: valid}
+		fs.AddFlag(f)
+	})
+}
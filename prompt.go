@@ -0,0 +1,81 @@
+package flagstruct
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	flag "github.com/spf13/pflag"
+)
+
+// for interactive prompt
+//
+// when Config.InteractivePrompt is true, the missing required flags are asked for by Config.PromptFunc.
+// if Config.PromptFunc is nil, the default prompt is used, only when stdin is a TTY (character device).
+// the default prompt refuses the sensitive field, because it cannot disable echo. (please use golang.org/x/term in your PromptFunc)
+
+func (b *Binder) promptRequiredFlags(fs *flag.FlagSet) error {
+	promptFunc := b.PromptFunc
+	if promptFunc == nil {
+		if !isTerminal(os.Stdin) {
+			return nil
+		}
+		promptFunc = defaultPromptFunc
+	}
+
+	for _, fc := range b.State.visitedFields {
+		if !fc.required {
+			continue
+		}
+		f := fs.Lookup(fc.fieldname)
+		if f == nil || f.Changed {
+			continue
+		}
+
+		v, err := promptFunc(fc.info())
+		if err != nil {
+			return fmt.Errorf("on prompt %s, %w", fc.fieldname, err)
+		}
+		if err := fs.Set(f.Name, v); err != nil {
+			return fmt.Errorf("on prompt %s=%v, %+v", fc.fieldname, v, err)
+		}
+		b.recordSource(f.Name, SourcePrompt)
+	}
+	return nil
+}
+
+func isTerminal(f *os.File) bool {
+	fi, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	return fi.Mode()&os.ModeCharDevice != 0
+}
+
+func defaultPromptFunc(field FieldInfo) (string, error) {
+	if field.Sensitive {
+		return "", fmt.Errorf("the sensitive field is not prompted with echo, please set Config.PromptFunc")
+	}
+	fmt.Fprintf(os.Stderr, "%s: ", field.Name)
+
+	// read byte by byte, not to consume the input for the next prompt
+	var sb strings.Builder
+	buf := make([]byte, 1)
+	for {
+		n, err := os.Stdin.Read(buf)
+		if n > 0 {
+			if buf[0] == '\n' {
+				break
+			}
+			sb.WriteByte(buf[0])
+		}
+		if err != nil {
+			if err == io.EOF {
+				break
+			}
+			return "", err
+		}
+	}
+	return strings.TrimRight(sb.String(), "\r"), nil
+}
@@ -0,0 +1,93 @@
+package flagstruct
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// for slice of pointers, e.g. []*int (each element is allocated on Set)
+
+type ptrSliceValue struct {
+	slice   reflect.Value // addressable slice value
+	changed bool
+}
+
+func newPtrSliceValue(fv reflect.Value) *ptrSliceValue {
+	switch fv.Type().Elem().Elem().Kind() {
+	case reflect.String, reflect.Int, reflect.Bool:
+		return &ptrSliceValue{slice: fv}
+	default:
+		panic(fmt.Sprintf("unsupported slice type %v", fv.Type()))
+	}
+}
+
+func (v *ptrSliceValue) Set(s string) error {
+	values, err := csv.NewReader(strings.NewReader(s)).Read()
+	if err != nil {
+		return err
+	}
+
+	rt := v.slice.Type().Elem().Elem()
+	elems := make([]reflect.Value, 0, len(values))
+	for _, x := range values {
+		ev := reflect.New(rt)
+		switch rt.Kind() {
+		case reflect.String:
+			ev.Elem().SetString(x)
+		case reflect.Int:
+			n, err := strconv.ParseInt(strings.TrimSpace(x), 0, 64)
+			if err != nil {
+				return err
+			}
+			ev.Elem().SetInt(n)
+		case reflect.Bool:
+			b, err := strconv.ParseBool(strings.TrimSpace(x))
+			if err != nil {
+				return err
+			}
+			ev.Elem().SetBool(b)
+		}
+		elems = append(elems, ev)
+	}
+
+	if !v.changed { // overwrite the default value
+		v.slice.Set(reflect.MakeSlice(v.slice.Type(), 0, len(elems)))
+		v.changed = true
+	}
+	v.slice.Set(reflect.Append(v.slice, elems...))
+	return nil
+}
+
+func (v *ptrSliceValue) String() string {
+	values := make([]string, v.slice.Len())
+	for i := 0; i < v.slice.Len(); i++ {
+		ev := v.slice.Index(i)
+		if ev.IsNil() {
+			values[i] = "<nil>"
+			continue
+		}
+		switch ev := ev.Elem(); ev.Kind() {
+		case reflect.String:
+			values[i] = ev.String()
+		case reflect.Int:
+			values[i] = strconv.FormatInt(ev.Int(), 10)
+		case reflect.Bool:
+			values[i] = strconv.FormatBool(ev.Bool())
+		}
+	}
+
+	b := &bytes.Buffer{}
+	w := csv.NewWriter(b)
+	w.Write(values)
+	w.Flush()
+	return "[" + strings.TrimSuffix(b.String(), "\n") + "]"
+}
+
+// for pflag.Value
+func (v *ptrSliceValue) Type() string {
+	return v.slice.Type().Elem().Elem().Kind().String() + "Slice" // e.g. intSlice
+}
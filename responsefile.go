@@ -0,0 +1,77 @@
+package flagstruct
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// for response file, e.g. `@args.txt`
+//
+// the response file contains one argument per line.
+// empty lines and lines beginning with "#" are ignored, and nested response files are also expanded.
+// (the path of a nested response file is relative to the file including it)
+
+func expandResponseFiles(args []string) ([]string, error) {
+	return expandResponseFilesRec(args, "", map[string]bool{})
+}
+
+func expandResponseFilesRec(args []string, dir string, seen map[string]bool) ([]string, error) {
+	r := make([]string, 0, len(args))
+	for i, arg := range args {
+		if arg == "--" {
+			r = append(r, args[i:]...)
+			break
+		}
+		if !strings.HasPrefix(arg, "@") || len(arg) == 1 {
+			r = append(r, arg)
+			continue
+		}
+
+		filename := arg[1:]
+		if dir != "" && !filepath.IsAbs(filename) {
+			filename = filepath.Join(dir, filename)
+		}
+		if seen[filename] {
+			return nil, fmt.Errorf("response file %q is included recursively", filename)
+		}
+
+		lines, err := readResponseFile(filename)
+		if err != nil {
+			return nil, err
+		}
+
+		seen[filename] = true
+		expanded, err := expandResponseFilesRec(lines, filepath.Dir(filename), seen)
+		if err != nil {
+			return nil, err
+		}
+		delete(seen, filename)
+		r = append(r, expanded...)
+	}
+	return r, nil
+}
+
+func readResponseFile(filename string) ([]string, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, fmt.Errorf("on response file %s, %w", filename, err)
+	}
+	defer f.Close()
+
+	var lines []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		lines = append(lines, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("on response file %s, %w", filename, err)
+	}
+	return lines, nil
+}
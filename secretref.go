@@ -0,0 +1,37 @@
+package flagstruct
+
+import (
+	"fmt"
+
+	flag "github.com/spf13/pflag"
+)
+
+// for secret references, e.g. `secretref:"vault:secret/db#password"`
+//
+// the reference is resolved by Config.SecretResolver in Parse, only if the flag is not set (by command-line, envvar).
+
+type secretRef struct {
+	fieldname string
+	ref       string
+}
+
+func (b *Binder) resolveSecretRefs(fs *flag.FlagSet) error {
+	for _, sr := range b.State.secretRefs {
+		f := fs.Lookup(sr.fieldname)
+		if f == nil || f.Changed {
+			continue
+		}
+		if b.SecretResolver == nil { // only required if the reference is resolved
+			return fmt.Errorf("Config.SecretResolver is not set (for secret reference of --%s)", sr.fieldname)
+		}
+		v, err := b.SecretResolver(sr.ref)
+		if err != nil {
+			return fmt.Errorf("on secret reference %q of --%s, %w", sr.ref, sr.fieldname, err)
+		}
+		if err := fs.Set(f.Name, v); err != nil {
+			return fmt.Errorf("on secret reference %q of --%s, %+v", sr.ref, sr.fieldname, err) // the value is not included, for safety
+		}
+		b.recordSource(f.Name, SourceSecret)
+	}
+	return nil
+}
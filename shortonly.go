@@ -0,0 +1,29 @@
+package flagstruct
+
+import (
+	"fmt"
+	"strings"
+
+	flag "github.com/spf13/pflag"
+)
+
+// for shorthand-only flag, e.g. `-v` without `--verbose` (the field is tagged with `shortonly:"true"`)
+//
+// pflag requires the long name, so the flag is registered with it (hidden in help),
+// and the long form in the arguments is rejected before parsing.
+
+func rejectShortOnlyFlags(fs *flag.FlagSet, shortOnly map[string]bool, args []string) error {
+	for _, arg := range args {
+		if arg == "--" {
+			break
+		}
+		if !strings.HasPrefix(arg, "--") {
+			continue
+		}
+		name := strings.SplitN(arg[2:], "=", 2)[0]
+		if shortOnly[string(fs.GetNormalizeFunc()(fs, name))] {
+			return fmt.Errorf("unknown flag: --%s", name)
+		}
+	}
+	return nil
+}
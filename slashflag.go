@@ -0,0 +1,59 @@
+package flagstruct
+
+import (
+	"strings"
+
+	flag "github.com/spf13/pflag"
+)
+
+// for Windows-style flag, e.g. `/name value`, `/name:value`, `/v`
+//
+// the argument beginning with "/" is rewritten to "--name" (or "-v" for the shorthand), only if it matches a known flag.
+// so the positional arguments like "/usr/local" are kept as is, and so are the values of the preceding flags (e.g. `--dir /tmp`).
+
+func rewriteSlashFlags(fs *flag.FlagSet, args []string) []string {
+	r := make([]string, 0, len(args))
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if arg == "--" {
+			r = append(r, args[i:]...)
+			break
+		}
+
+		var f *flag.Flag
+		switch {
+		case strings.HasPrefix(arg, "/") && len(arg) > 1:
+			name, value, hasValue := arg[1:], "", false
+			if j := strings.IndexAny(name, ":="); j >= 0 {
+				name, value, hasValue = name[:j], name[j+1:], true
+			}
+			if f = fs.Lookup(name); f != nil {
+				arg = "--" + f.Name
+			} else if len(name) == 1 {
+				if f = fs.ShorthandLookup(name); f != nil {
+					arg = "-" + f.Shorthand
+				}
+			}
+			if f == nil { // not a flag (e.g. a path)
+				r = append(r, args[i])
+				continue
+			}
+			if hasValue {
+				arg += "=" + value
+				f = nil // the value is included
+			}
+		case strings.HasPrefix(arg, "--") && len(arg) > 2 && !strings.Contains(arg, "="):
+			f = fs.Lookup(arg[2:])
+		case strings.HasPrefix(arg, "-") && len(arg) == 2:
+			f = fs.ShorthandLookup(arg[1:])
+		}
+		r = append(r, arg)
+
+		// the next argument is the value of the flag (e.g. `/dir /tmp`), not to be rewritten
+		if f != nil && f.NoOptDefVal == "" && i+1 < len(args) {
+			i++
+			r = append(r, args[i])
+		}
+	}
+	return r
+}
@@ -0,0 +1,44 @@
+package flagstruct
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	flag "github.com/spf13/pflag"
+)
+
+// for reading the value from stdin, e.g. `echo hello | cmd --body -`
+// (the field is tagged with `stdin:"true"`, the reader is Config.Stdin, or os.Stdin if nil)
+//
+// stdin can be read only once, so the second "-" is an error (even if it is for the other flag).
+// the trailing newline is trimmed, as same as FromFileTag.
+
+type stdinValue struct {
+	flag.Value
+	name   string
+	binder *Binder
+}
+
+func (v *stdinValue) Set(s string) error {
+	if s != "-" {
+		return v.Value.Set(s)
+	}
+
+	b := v.binder
+	if b.State.stdinConsumer != "" {
+		return fmt.Errorf("stdin is already consumed by --%s", b.State.stdinConsumer)
+	}
+	b.State.stdinConsumer = v.name
+
+	r := b.Stdin
+	if r == nil {
+		r = os.Stdin
+	}
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return fmt.Errorf("on reading value from stdin, %w", err)
+	}
+	return v.Value.Set(strings.TrimRight(string(data), "\r\n"))
+}
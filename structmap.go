@@ -0,0 +1,149 @@
+package flagstruct
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+
+	flag "github.com/spf13/pflag"
+)
+
+// for map of struct, e.g. `--servers.web.port 8080 --servers.db.port 5432`
+//
+// the syntax is --<field>.<key>.<leaf>, the key must not contain "." (and must not be empty).
+// as same as struct slice, the flags of each entry are registered on demand (before parsing),
+// and the entry is added when a new key appears. (only one level deep, and string/int/bool fields are supported)
+
+type structMapField struct {
+	fieldname string
+	value     reflect.Value // addressable map value
+}
+
+// registerStructMapElem registers the flags of the entry of the key. (if already registered, nothing is done)
+func (b *Binder) registerStructMapElem(fs *flag.FlagSet, sf structMapField, key string) {
+	rt := sf.value.Type().Elem()
+	prefix := fmt.Sprintf("%s.%s.", sf.fieldname, key)
+	for j := 0; j < rt.NumField(); j++ {
+		rf := rt.Field(j)
+		fieldname, _, skip := b.lookupFlagname(rf, prefix)
+		if skip || !rf.IsExported() {
+			continue
+		}
+		if fs.Lookup(fieldname) != nil {
+			continue
+		}
+
+		switch rf.Type.Kind() {
+		case reflect.String, reflect.Int, reflect.Bool:
+		default:
+			panic(fmt.Sprintf("unsupported type %v in struct map %v", rf.Type, sf.value.Type()))
+		}
+
+		helpText := "-"
+		if v, ok := rf.Tag.Lookup(b.HelpTextTag); ok {
+			helpText = v
+		}
+		helpText = b.envHelpText(fieldname) + helpText
+		f := fs.VarPF(&structMapElemValue{m: sf.value, key: key, field: j}, fieldname, "", helpText)
+		if rf.Type.Kind() == reflect.Bool {
+			f.NoOptDefVal = "true"
+		}
+		b.onFlagRegistered(f, rf)
+	}
+}
+
+// registerStructMapFlags registers the flags of the entries, found in args.
+func (b *Binder) registerStructMapFlags(fs *flag.FlagSet, args []string) {
+	if len(b.State.structMapFields) == 0 {
+		return
+	}
+	normalize := fs.GetNormalizeFunc()
+	for _, arg := range args {
+		if arg == "--" {
+			return
+		}
+		if !strings.HasPrefix(arg, "--") {
+			continue
+		}
+		name := strings.SplitN(arg[2:], "=", 2)[0]
+		if fs.Lookup(name) != nil {
+			continue
+		}
+		name = string(normalize(fs, name))
+
+		for _, sf := range b.State.structMapFields {
+			prefix := string(normalize(fs, sf.fieldname)) + "."
+			if !strings.HasPrefix(name, prefix) {
+				continue
+			}
+			parts := strings.SplitN(strings.TrimPrefix(name, prefix), ".", 2)
+			if len(parts) != 2 || parts[0] == "" {
+				continue
+			}
+			b.registerStructMapElem(fs, sf, parts[0])
+			break
+		}
+	}
+}
+
+type structMapElemValue struct {
+	m     reflect.Value
+	key   string
+	field int
+}
+
+func (v *structMapElemValue) Set(s string) error {
+	// the entry of map is not addressable, so modifying the copy and storing it
+	elem := reflect.New(v.m.Type().Elem()).Elem()
+	if v.m.IsNil() {
+		v.m.Set(reflect.MakeMap(v.m.Type()))
+	} else if existing := v.m.MapIndex(reflect.ValueOf(v.key).Convert(v.m.Type().Key())); existing.IsValid() {
+		elem.Set(existing)
+	}
+
+	fv := elem.Field(v.field)
+	switch fv.Kind() {
+	case reflect.String:
+		fv.SetString(s)
+	case reflect.Int:
+		n, err := strconv.ParseInt(s, 0, 64)
+		if err != nil {
+			return err
+		}
+		fv.SetInt(n)
+	case reflect.Bool:
+		x, err := strconv.ParseBool(s)
+		if err != nil {
+			return err
+		}
+		fv.SetBool(x)
+	}
+	v.m.SetMapIndex(reflect.ValueOf(v.key).Convert(v.m.Type().Key()), elem)
+	return nil
+}
+
+func (v *structMapElemValue) String() string {
+	if v.m.IsNil() {
+		return ""
+	}
+	elem := v.m.MapIndex(reflect.ValueOf(v.key).Convert(v.m.Type().Key()))
+	if !elem.IsValid() {
+		return ""
+	}
+	fv := elem.Field(v.field)
+	switch fv.Kind() {
+	case reflect.String:
+		return fv.String()
+	case reflect.Int:
+		return strconv.FormatInt(fv.Int(), 10)
+	case reflect.Bool:
+		return strconv.FormatBool(fv.Bool())
+	}
+	return ""
+}
+
+// for pflag.Value
+func (v *structMapElemValue) Type() string {
+	return v.m.Type().Elem().Field(v.field).Type.String()
+}
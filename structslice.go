@@ -0,0 +1,146 @@
+package flagstruct
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+
+	flag "github.com/spf13/pflag"
+)
+
+// for struct slice, e.g. `--items.0.name foo --items.1.name bar`
+//
+// the flags of each element are registered on demand (before parsing),
+// and the slice grows when a new index appears. (only one level deep, and string/int fields are supported)
+// the index must be at most the current length (e.g. --items.1.name after --items.0.name), and less than maxlen if the field has it.
+
+type structSliceField struct {
+	fieldname string
+	value     reflect.Value // addressable slice value
+	max       int           // the maximum number of elements (maxlen tag), -1 is unlimited
+}
+
+// registerStructSliceElem registers the flags of the i-th element.
+func (b *Binder) registerStructSliceElem(fs *flag.FlagSet, sf structSliceField, i int) {
+	rt := sf.value.Type().Elem()
+	prefix := fmt.Sprintf("%s.%d.", sf.fieldname, i)
+	for j := 0; j < rt.NumField(); j++ {
+		rf := rt.Field(j)
+		fieldname, _, skip := b.lookupFlagname(rf, prefix)
+		if skip || !rf.IsExported() {
+			continue
+		}
+		if fs.Lookup(fieldname) != nil {
+			continue
+		}
+
+		switch rf.Type.Kind() {
+		case reflect.String, reflect.Int:
+		default:
+			panic(fmt.Sprintf("unsupported type %v in struct slice %v", rf.Type, sf.value.Type()))
+		}
+
+		helpText := "-"
+		if v, ok := rf.Tag.Lookup(b.HelpTextTag); ok {
+			helpText = v
+		}
+		helpText = b.envHelpText(fieldname) + helpText
+		fs.Var(&structSliceElemValue{slice: sf.value, index: i, field: j, max: sf.max}, fieldname, helpText)
+		b.onFlagRegistered(fs.Lookup(fieldname), rf)
+	}
+}
+
+// registerStructSliceFlags registers the flags of the elements, found in args.
+func (b *Binder) registerStructSliceFlags(fs *flag.FlagSet, args []string) {
+	if len(b.State.structSliceFields) == 0 {
+		return
+	}
+	normalize := fs.GetNormalizeFunc()
+	for _, arg := range args {
+		if arg == "--" {
+			return
+		}
+		if !strings.HasPrefix(arg, "--") {
+			continue
+		}
+		name := strings.SplitN(arg[2:], "=", 2)[0]
+		if fs.Lookup(name) != nil {
+			continue
+		}
+		name = string(normalize(fs, name))
+
+		for _, sf := range b.State.structSliceFields {
+			prefix := string(normalize(fs, sf.fieldname)) + "."
+			if !strings.HasPrefix(name, prefix) {
+				continue
+			}
+			parts := strings.SplitN(strings.TrimPrefix(name, prefix), ".", 2)
+			if len(parts) != 2 {
+				continue
+			}
+			i, err := strconv.Atoi(parts[0])
+			if err != nil || i < 0 || parts[0] != strconv.Itoa(i) {
+				continue
+			}
+			b.registerStructSliceElem(fs, sf, i)
+			break
+		}
+	}
+}
+
+type structSliceElemValue struct {
+	slice reflect.Value
+	index int
+	field int
+	max   int // -1 is unlimited
+}
+
+func (v *structSliceElemValue) fieldValue() (reflect.Value, error) {
+	if v.max >= 0 && v.index >= v.max {
+		return reflect.Value{}, fmt.Errorf("must have at most %d elements, but %d", v.max, v.index+1)
+	}
+	if n := v.slice.Len(); v.index > n {
+		return reflect.Value{}, fmt.Errorf("index %d is out of range (the next index is %d)", v.index, n)
+	} else if v.index == n {
+		v.slice.Set(reflect.Append(v.slice, reflect.New(v.slice.Type().Elem()).Elem()))
+	}
+	return v.slice.Index(v.index).Field(v.field), nil
+}
+
+func (v *structSliceElemValue) Set(s string) error {
+	fv, err := v.fieldValue()
+	if err != nil {
+		return err
+	}
+	switch fv.Kind() {
+	case reflect.String:
+		fv.SetString(s)
+	case reflect.Int:
+		n, err := strconv.ParseInt(s, 0, 64)
+		if err != nil {
+			return err
+		}
+		fv.SetInt(n)
+	}
+	return nil
+}
+
+func (v *structSliceElemValue) String() string {
+	if v.slice.Len() <= v.index {
+		return ""
+	}
+	fv := v.slice.Index(v.index).Field(v.field)
+	switch fv.Kind() {
+	case reflect.String:
+		return fv.String()
+	case reflect.Int:
+		return strconv.FormatInt(fv.Int(), 10)
+	}
+	return ""
+}
+
+// for pflag.Value
+func (v *structSliceElemValue) Type() string {
+	return v.slice.Type().Elem().Field(v.field).Type.String()
+}
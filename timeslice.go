@@ -0,0 +1,52 @@
+package flagstruct
+
+import (
+	"encoding/csv"
+	"strings"
+	"time"
+)
+
+// for []time.Time, parsing each element with the layout
+
+type timeSliceValue struct {
+	p       *[]time.Time
+	layout  string
+	changed bool
+}
+
+func (v *timeSliceValue) Set(s string) error {
+	values, err := csv.NewReader(strings.NewReader(s)).Read()
+	if err != nil {
+		return err
+	}
+
+	out := make([]time.Time, 0, len(values))
+	for _, x := range values {
+		t, err := time.Parse(v.layout, strings.TrimSpace(x))
+		if err != nil {
+			return err
+		}
+		out = append(out, t)
+	}
+
+	if !v.changed { // overwrite the default value
+		*v.p = out
+		v.changed = true
+		return nil
+	}
+	*v.p = append(*v.p, out...)
+	return nil
+}
+
+func (v *timeSliceValue) String() string {
+	values := make([]string, len(*v.p))
+	for i, t := range *v.p {
+		values[i] = t.Format(v.layout)
+	}
+	return "[" + strings.Join(values, ",") + "]"
+}
+
+// for pflag.Value
+func (v *timeSliceValue) Type() string {
+	return "timeSlice"
+}
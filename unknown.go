@@ -0,0 +1,63 @@
+package flagstruct
+
+import (
+	"strings"
+
+	flag "github.com/spf13/pflag"
+)
+
+// for unknown flags
+//
+// pflag ignores the unknown flags with ParseErrorsWhitelist.UnknownFlags, but the ignored tokens are not preserved.
+// so collecting them before parsing, in the same manner as pflag. (e.g. `--unknown value` is treated as a pair)
+
+func collectUnknownFlags(fs *flag.FlagSet, args []string) []string {
+	var unknown []string
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if arg == "--" {
+			break
+		}
+		if len(arg) < 2 || arg[0] != '-' {
+			continue
+		}
+
+		var f *flag.Flag
+		hasValue := false
+		if strings.HasPrefix(arg, "--") {
+			parts := strings.SplitN(arg[2:], "=", 2)
+			f = fs.Lookup(parts[0])
+			hasValue = len(parts) == 2
+		} else {
+			shorthands := arg[1:]
+			if strings.Contains(shorthands, "=") {
+				shorthands = strings.SplitN(shorthands, "=", 2)[0]
+				hasValue = true
+			}
+			for j := 0; j < len(shorthands); j++ {
+				f = fs.ShorthandLookup(shorthands[j : j+1])
+				if f == nil {
+					break
+				}
+				if f.NoOptDefVal == "" { // the rest is the value (e.g. -n10)
+					hasValue = hasValue || j+1 < len(shorthands)
+					break
+				}
+			}
+		}
+
+		if f != nil {
+			if !hasValue && f.NoOptDefVal == "" {
+				i++ // skip the value of the known flag
+			}
+			continue
+		}
+
+		unknown = append(unknown, arg)
+		if !hasValue && i+1 < len(args) && !strings.HasPrefix(args[i+1], "-") {
+			i++
+			unknown = append(unknown, args[i])
+		}
+	}
+	return unknown
+}
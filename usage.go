@@ -0,0 +1,240 @@
+package flagstruct
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"text/template"
+
+	flag "github.com/spf13/pflag"
+)
+
+// GroupedFlagUsages returns the usage string grouped by the nested struct.
+// (the flags of the toplevel struct are first, and the others follow with a header per group)
+// the header includes the description of the group, if the nested struct field has GroupTag. (e.g. "tls (TLS options):")
+func (fs *FlagSet) GroupedFlagUsages() string {
+	normalize := fs.GetNormalizeFunc()
+	prefixMap := map[string]string{}
+	groupMap := map[string]string{}
+	var prefixes []string
+	seen := map[string]bool{"": true}
+	for _, fc := range fs.Binder.State.visitedFields {
+		prefixMap[string(normalize(fs.FlagSet, fc.fieldname))] = fc.prefix
+		if fc.group != "" {
+			groupMap[fs.Binder.nestedPrefix(fc)] = fc.group
+		}
+		if !seen[fc.prefix] {
+			seen[fc.prefix] = true
+			prefixes = append(prefixes, fc.prefix)
+		}
+	}
+
+	groups := map[string]*flag.FlagSet{}
+	fs.VisitAll(func(f *flag.Flag) {
+		prefix := prefixMap[f.Name] // not found is treated as toplevel (e.g. --version)
+		g, ok := groups[prefix]
+		if !ok {
+			g = flag.NewFlagSet(prefix, flag.ContinueOnError)
+			g.SortFlags = fs.SortFlags
+			groups[prefix] = g
+		}
+		g.AddFlag(fs.usageFlag(f))
+	})
+
+	var b strings.Builder
+	if g, ok := groups[""]; ok {
+		b.WriteString(g.FlagUsages())
+	}
+	for _, prefix := range prefixes {
+		g, ok := groups[prefix]
+		if !ok {
+			continue
+		}
+		b.WriteString("\n")
+		b.WriteString(strings.TrimSuffix(prefix, "."))
+		if group := groupMap[prefix]; group != "" {
+			b.WriteString(" (" + group + ")")
+		}
+		b.WriteString(":\n")
+		b.WriteString(g.FlagUsages())
+	}
+	return b.String()
+}
+
+// FlagUsages is like pflag.FlagSet.FlagUsages, but the zero default values are omitted if Config.HideZeroDefaults is true.
+func (fs *FlagSet) FlagUsages() string {
+	if len(fs.Binder.State.zeroDefaults) == 0 {
+		return fs.FlagSet.FlagUsages()
+	}
+	tmp := flag.NewFlagSet(fs.Binder.State.name, flag.ContinueOnError)
+	tmp.SortFlags = fs.SortFlags
+	fs.VisitAll(func(f *flag.Flag) {
+		tmp.AddFlag(fs.usageFlag(f))
+	})
+	return tmp.FlagUsages()
+}
+
+// usageFlag returns the flag for rendering the usage. (the copy without the default value annotation, if HideZeroDefaults)
+func (fs *FlagSet) usageFlag(f *flag.Flag) *flag.Flag {
+	if !fs.Binder.State.zeroDefaults[f.Name] {
+		return f
+	}
+	g := *f
+	g.Value = &zeroDefaultValue{Value: f.Value}
+	return &g
+}
+
+type flagHelp struct {
+	Name      string   `json:"name"`
+	Shorthand string   `json:"shorthand,omitempty"`
+	Type      string   `json:"type"`
+	Default   string   `json:"default"`
+	Env       string   `json:"env,omitempty"`
+	Help      string   `json:"help"`
+	Required  bool     `json:"required"`
+	Path      string   `json:"path,omitempty"` // the path of the nested struct (e.g. "db")
+	Allowed   []string `json:"allowed,omitempty"`
+}
+
+// HelpJSON returns the help of the flags as JSON array, in flag-declaration order. (for machine consumption)
+func (fs *FlagSet) HelpJSON() ([]byte, error) {
+	r := []flagHelp{}
+	for _, fc := range fs.Binder.State.visitedFields {
+		f := fs.Lookup(fc.fieldname)
+		if f == nil { // skip the nested struct itself
+			continue
+		}
+		r = append(r, flagHelp{
+			Name:      f.Name,
+			Shorthand: f.Shorthand,
+			Type:      f.Value.Type(),
+			Default:   f.DefValue,
+			Env:       fc.envName,
+			Help:      fc.description,
+			Required:  fc.required,
+			Path:      strings.TrimSuffix(fc.prefix, "."),
+			Allowed:   fc.allowedValues,
+		})
+	}
+	return json.MarshalIndent(r, "", "  ")
+}
+
+// PrintDefaultsMarkdown prints the flags as Markdown table, in flag-declaration order. (for docs generation)
+// The columns are Flag, Shorthand, Env, Default, Description. (hidden flags are skipped)
+func (fs *FlagSet) PrintDefaultsMarkdown(w io.Writer) {
+	fmt.Fprintln(w, "| Flag | Shorthand | Env | Default | Description |")
+	fmt.Fprintln(w, "| --- | --- | --- | --- | --- |")
+	for _, fc := range fs.Binder.State.visitedFields {
+		f := fs.Lookup(fc.fieldname)
+		if f == nil || f.Hidden { // skip the nested struct itself
+			continue
+		}
+
+		shorthand := ""
+		if f.Shorthand != "" {
+			shorthand = "`-" + f.Shorthand + "`"
+		}
+		env := ""
+		if fc.envName != "" {
+			env = "`" + fc.envName + "`"
+		}
+		defValue := ""
+		if f.DefValue != "" {
+			defValue = "`" + f.DefValue + "`"
+		}
+		description := fc.description
+		if description == "-" {
+			description = ""
+		}
+		if fc.required {
+			description = strings.TrimSpace(description + " (required)")
+		}
+		fmt.Fprintf(w, "| `--%s` | %s | %s | %s | %s |\n", f.Name, shorthand, env, escapeMarkdownCell(defValue), escapeMarkdownCell(description))
+	}
+}
+
+// WriteEnvTemplate writes the commented .env template, in flag-declaration order. (hidden flags and flags without envvar are skipped)
+// For each flag, the help text is written as a comment, followed by ENVNAME=<default>. (the default of sensitive flags is omitted)
+func (fs *FlagSet) WriteEnvTemplate(w io.Writer) error {
+	first := true
+	for _, fc := range fs.Binder.State.visitedFields {
+		f := fs.Lookup(fc.fieldname)
+		if f == nil || f.Hidden || fc.envName == "" { // skip the nested struct itself
+			continue
+		}
+
+		if !first {
+			if _, err := fmt.Fprintln(w); err != nil {
+				return err
+			}
+		}
+		first = false
+
+		description := fc.description
+		if description == "-" {
+			description = ""
+		}
+		if fc.required {
+			description = strings.TrimSpace(description + " (required)")
+		}
+		for _, line := range strings.Split(description, "\n") {
+			if line == "" {
+				continue
+			}
+			if _, err := fmt.Fprintf(w, "# %s\n", line); err != nil {
+				return err
+			}
+		}
+
+		value := ""
+		if !fc.sensitive {
+			value = envTemplateValue(f)
+		}
+		if _, err := fmt.Fprintf(w, "%s=%s\n", fc.envName, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func envTemplateValue(f *flag.Flag) string {
+	v := f.DefValue
+	if isSliceFlag(f) { // e.g. [a,b] -> a,b
+		v = strings.TrimSuffix(strings.TrimPrefix(v, "["), "]")
+	}
+	if strings.ContainsAny(v, " \t#\"'") {
+		return strconv.Quote(v)
+	}
+	return v
+}
+
+func escapeMarkdownCell(s string) string {
+	s = strings.ReplaceAll(s, "|", "\\|")
+	return strings.ReplaceAll(s, "\n", "<br>")
+}
+
+// HelpTemplateData is the data for help text template, when Config.HelpTemplates is true.
+// e.g. `help:"timeout (default {{.Default}}, env {{.Env}})"`
+type HelpTemplateData struct {
+	Name    string // the flag name (e.g. "db.uri")
+	Default string // the displayed default value
+	Env     string // the envvar name (empty if not supported)
+	Type    string // the type name of the flag value (e.g. "duration")
+}
+
+func renderHelpTemplate(text string, data HelpTemplateData) (string, error) {
+	if !strings.Contains(text, "{{") {
+		return text, nil
+	}
+	tmpl, err := template.New(data.Name).Parse(text)
+	if err != nil {
+		return "", err
+	}
+	var b strings.Builder
+	if err := tmpl.Execute(&b, data); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}